@@ -0,0 +1,469 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS Message (
+	id INTEGER NOT NULL PRIMARY KEY,
+	author INTEGER NOT NULL,
+	channel INTEGER NOT NULL,
+	guild INTEGER,
+	content TEXT NOT NULL,
+	json TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS MessageEdit (
+	id INTEGER NOT NULL,
+	edited INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	json TEXT NOT NULL,
+	PRIMARY KEY (id, edited)
+);
+`
+
+var stmtInsert *sql.Stmt
+
+// outputOptions configure how an archive is stored.
+type outputOptions struct {
+	// file is the name of the message log, without its extension. It
+	// defaults to "messages".
+	file string
+	// instance, if not empty, makes messages be stored in a database of
+	// that instance's own, so that several instances can share the archive
+	// directory. Only one process may use a database at a time.
+	instance string
+	// dirMode and fileMode are the permissions of the directories and
+	// files created in the archive.
+	dirMode  os.FileMode
+	fileMode os.FileMode
+}
+
+// newOutput opens the archive in dir.
+func newOutput(dir string, opts outputOptions) (*output, error) {
+	o := &output{
+		client:   newAttachmentClient(),
+		dirMode:  opts.dirMode,
+		fileMode: opts.fileMode,
+	}
+	err := o.mkdir(dir)
+	if err != nil {
+		return nil, err
+	}
+	db := opts.file
+	if db == "" {
+		db = "messages"
+	}
+	if opts.instance != "" {
+		db += "-" + opts.instance
+	}
+	db += ".db"
+	o.lock, err = lockFile(path.Join(dir, db+".lock"), o.fileMode)
+	if err != nil {
+		return nil, err
+	}
+	// Create the database ourselves, since SQLite would use its own
+	// permissions.
+	f, err := os.OpenFile(path.Join(dir, db), os.O_RDWR|os.O_CREATE, o.fileMode)
+	if err != nil {
+		o.lock.Close()
+		return nil, err
+	}
+	f.Close()
+	o.DB, err = sql.Open("sqlite3", path.Join(dir, db))
+	if err != nil {
+		o.lock.Close()
+		return nil, err
+	}
+	_, err = o.Exec(schema)
+	if err != nil {
+		o.DB.Close()
+		o.lock.Close()
+		return nil, err
+	}
+	stmtInsert, err = o.Prepare("INSERT INTO Message (id, author, channel, guild, content, json) VALUES(?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		o.DB.Close()
+		o.lock.Close()
+		return nil, err
+	}
+	o.attdir = path.Join(dir, "attachments")
+	return o, nil
+}
+
+// newZipOutput opens an archive kept in the zip file name, which mustn't
+// exist yet.
+func newZipOutput(name string, opts outputOptions) (*output, error) {
+	z, err := newZipArchive(name, opts.fileMode)
+	if err != nil {
+		return nil, err
+	}
+	return &output{
+		zip:      z,
+		client:   newAttachmentClient(),
+		attdir:   "attachments",
+		fileMode: opts.fileMode,
+	}, nil
+}
+
+type output struct {
+	*sql.DB
+	// zip, if set, is the archive instead of the database and the
+	// attachments directory.
+	zip      *zipArchive
+	lock     *os.File
+	client   *http.Client
+	attdir   string
+	dirMode  os.FileMode
+	fileMode os.FileMode
+	// trackEdits makes logMessage archive new versions of messages that
+	// were already archived, instead of ignoring them.
+	trackEdits bool
+	// noAttachments makes logMessage only record attachments, without
+	// downloading them.
+	noAttachments bool
+	// attachmentTypes, if set, makes logMessage only download attachments
+	// of these types, and only record the others.
+	attachmentTypes []string
+	// redact makes logMessage archive the hash of message contents instead
+	// of the contents, and leave out embed descriptions.
+	redact bool
+	// refresh, if set, fetches a message again to get fresh attachment
+	// URLs when the ones it was found with have expired.
+	refresh func(discord.ChannelID, discord.MessageID) (*discord.Message, error)
+}
+
+// mkdir creates dir and any missing parents, and gives dir the archive's
+// directory permissions regardless of the umask.
+func (o *output) mkdir(dir string) error {
+	if o.zip != nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, o.dirMode); err != nil {
+		return err
+	}
+	return os.Chmod(dir, o.dirMode)
+}
+
+func (o *output) Close() error {
+	if o.zip != nil {
+		return o.zip.Close()
+	}
+	err := o.DB.Close()
+	o.lock.Close()
+	return err
+}
+
+// archivedMessage is the JSON stored for each archived message.
+type archivedMessage struct {
+	discord.Message
+	// MissingAttachments are the indices of the attachments that couldn't
+	// be downloaded because their URLs expired.
+	MissingAttachments []int `json:"missing_attachments,omitempty"`
+	// ContentSHA256 is the hash of the content, as computed by contentHash,
+	// if the content was redacted.
+	ContentSHA256 string `json:"content_sha256,omitempty"`
+}
+
+func (o *output) logMessage(m discord.Message) error {
+	var missing []int
+	if !o.noAttachments {
+		var err error
+		missing, err = o.saveAttachments(m)
+		if err != nil {
+			return err
+		}
+	}
+	var hash string
+	if o.redact {
+		hash = contentHash(m.Content)
+		m = redacted(m)
+	}
+	content := m.Content
+	m.Content = ""
+	if o.zip != nil {
+		m.Content = content
+		j, err := json.Marshal(archivedMessage{m, missing, hash})
+		if err != nil {
+			return err
+		}
+		return o.zip.addMessage(m, j)
+	}
+	j, err := json.Marshal(archivedMessage{m, missing, hash})
+	if err != nil {
+		return err
+	}
+	guildID := sql.NullInt64{
+		Int64: int64(m.GuildID),
+		Valid: m.GuildID.IsValid(),
+	}
+	if _, err := stmtInsert.Exec(m.ID, m.Author.ID, m.ChannelID, guildID, content, j); err != nil {
+		if e, ok := err.(sqlite3.Error); !ok || e.Code != sqlite3.ErrConstraint {
+			return err
+		}
+		if o.trackEdits {
+			return o.logEdit(m, content, j)
+		}
+	}
+	return nil
+}
+
+// attachmentDir returns the directory of the attachments of m.
+func (o *output) attachmentDir(m discord.Message) string {
+	var guild string
+	if !m.GuildID.IsValid() {
+		guild = "dm"
+	} else {
+		guild = m.GuildID.String()
+	}
+	return path.Join(o.attdir, guild, m.ChannelID.String())
+}
+
+// attachmentPath returns the path of the nth attachment of m.
+func (o *output) attachmentPath(m discord.Message, n int) string {
+	return path.Join(o.attachmentDir(m), fmt.Sprintf("%d,%d %s",
+		m.ID,
+		n,
+		m.Attachments[n].Filename,
+	))
+}
+
+// verify checks that m and, unless they aren't downloaded, its attachments
+// are in the archive.
+func (o *output) verify(m discord.Message) error {
+	var archived bool
+	if o.zip != nil {
+		archived = o.zip.ids[m.ID]
+	} else {
+		err := o.QueryRow("SELECT EXISTS(SELECT 1 FROM Message WHERE id = ?)", m.ID).Scan(&archived)
+		if err != nil {
+			return err
+		}
+	}
+	if !archived {
+		return errors.New("message isn't in the archive")
+	}
+	if o.noAttachments {
+		return nil
+	}
+	for n, att := range m.Attachments {
+		if o.wants(att) && !o.complete(o.attachmentPath(m, n), att.Size) {
+			return &missingAttachmentError{att.Filename}
+		}
+	}
+	return nil
+}
+
+// missingAttachmentError is returned by verify for a message whose
+// attachment isn't in the archive, as when its URL expired.
+type missingAttachmentError struct {
+	name string
+}
+
+func (e *missingAttachmentError) Error() string {
+	return fmt.Sprintf("attachment %s isn't in the archive", e.name)
+}
+
+// attachmentTypes are the types of attachments -archive-types accepts.
+var attachmentTypes = []string{"image", "video", "audio", "text", "other"}
+
+// attachmentType returns one of attachmentTypes for att, by its MIME type or
+// else its extension.
+func attachmentType(att discord.Attachment) string {
+	ct := att.ContentType
+	if ct == "" {
+		ct = mime.TypeByExtension(path.Ext(att.Filename))
+	}
+	kind, _, _ := strings.Cut(ct, "/")
+	if contains(attachmentTypes, kind) {
+		return kind
+	}
+	return "other"
+}
+
+// wants reports whether att is to be downloaded into the archive.
+func (o *output) wants(att discord.Attachment) bool {
+	return len(o.attachmentTypes) == 0 || contains(o.attachmentTypes, attachmentType(att))
+}
+
+// redacted returns m without its content and embed descriptions.
+func redacted(m discord.Message) discord.Message {
+	m.Content = ""
+	embeds := make([]discord.Embed, len(m.Embeds))
+	for i, e := range m.Embeds {
+		e.Description = ""
+		embeds[i] = e
+	}
+	m.Embeds = embeds
+	return m
+}
+
+// saveAttachments downloads the attachments of m that aren't already in the
+// archive in full. It returns the indices of the attachments whose URLs
+// expired and couldn't be refreshed.
+func (o *output) saveAttachments(m discord.Message) ([]int, error) {
+	err := o.mkdir(o.attachmentDir(m))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		fresh   *discord.Message
+		missing []int
+		// stale is set once refreshing the URLs failed, which isn't tried
+		// again for the message's other attachments.
+		stale bool
+	)
+	for n, att := range m.Attachments {
+		attf := o.attachmentPath(m, n)
+		if !o.wants(att) || o.complete(attf, att.Size) {
+			continue
+		}
+		err := o.download(attf, att.URL)
+		if errors.Is(err, errExpired) && o.refresh != nil {
+			// Attachment URLs are signed and expire, so fetch the message
+			// again for fresh ones.
+			if fresh == nil && !stale {
+				var rerr error
+				fresh, rerr = o.refresh(m.ChannelID, m.ID)
+				if rerr != nil {
+					log.Printf("Warning: couldn't refresh the attachment URLs of %s: %s\n", m.URL(), rerr)
+					stale = true
+				}
+			}
+			if fresh != nil && n < len(fresh.Attachments) {
+				err = o.download(attf, fresh.Attachments[n].URL)
+			}
+		}
+		if errors.Is(err, errExpired) {
+			log.Printf("Warning: attachment %s of %s expired\n", att.Filename, m.URL())
+			missing = append(missing, n)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// logEdit archives m as a new version of an already archived message, if
+// its content or edited timestamp differ from the archived one.
+func (o *output) logEdit(m discord.Message, content string, j []byte) error {
+	var (
+		oldContent string
+		oldJSON    []byte
+		old        discord.Message
+	)
+	err := o.QueryRow("SELECT content, json FROM Message WHERE id = ?", m.ID).Scan(&oldContent, &oldJSON)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(oldJSON, &old); err != nil {
+		return err
+	}
+	if oldContent == content && old.EditedTimestamp == m.EditedTimestamp {
+		return nil
+	}
+	var edited int64
+	if m.EditedTimestamp.IsValid() {
+		edited = m.EditedTimestamp.Time().UnixMilli()
+	}
+	_, err = o.Exec("INSERT OR IGNORE INTO MessageEdit (id, edited, content, json) VALUES(?, ?, ?, ?)", m.ID, edited, content, j)
+	return err
+}
+
+// messages calls fn with every archived message, in order of ID.
+func (o *output) messages(fn func(discord.Message) error) error {
+	rows, err := o.Query("SELECT content, json FROM Message ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			content string
+			j       []byte
+			m       discord.Message
+		)
+		if err := rows.Scan(&content, &j); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(j, &m); err != nil {
+			return err
+		}
+		m.Content = content
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// errExpired is returned by download when the attachment URL has expired.
+var errExpired = errors.New("attachment URL expired")
+
+// complete reports whether the archive has the file name, and it's size
+// bytes long if size isn't 0. Interrupted downloads of older versions left
+// files short of their size behind.
+func (o *output) complete(name string, size uint64) bool {
+	if o.zip != nil {
+		return o.zip.exists(name)
+	}
+	fi, err := os.Stat(name)
+	return err == nil && (size == 0 || uint64(fi.Size()) == size)
+}
+
+// download downloads the attachment at url into the file name.
+func (o *output) download(name, url string) error {
+	resp, err := o.client.Get(url)
+	if err != nil {
+		return fmt.Errorf("requesting attachment contents: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain what's left of the body so the connection can be reused.
+	defer io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound:
+		return errExpired
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("requesting attachment contents: %s", resp.Status)
+	}
+	if o.zip != nil {
+		if err := o.zip.write(name, resp.Body); err != nil {
+			return fmt.Errorf("downloading attachment: %w", err)
+		}
+		return nil
+	}
+	// The attachment is downloaded next to its file and renamed once it's
+	// complete, so that an interrupted download doesn't pass for one.
+	part := name + ".part"
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, o.fileMode)
+	if err != nil {
+		return fmt.Errorf("creating attachment file: %w", err)
+	}
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(part, name)
+	}
+	if err != nil {
+		os.Remove(part)
+		return fmt.Errorf("downloading attachment: %w", err)
+	}
+	return nil
+}
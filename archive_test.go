@@ -0,0 +1,116 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterruptedDownload(t *testing.T) {
+	const gid, chid = 5, 10
+	f := newFakeDiscord(testMessage(testID(0), gid, chid, testSelf, "hello"))
+	data := bytes.Repeat([]byte("attachment "), 1000)
+	f.attach(t, testID(0), "file.txt", data)
+	f.cutOff["file.txt"] = true
+	dir := t.TempDir()
+	name := filepath.Join(dir, "attachments", "5", "10", testID(0).String()+",0 file.txt")
+
+	// The run stops at the broken off download, leaving nothing behind.
+	if out, err := f.runErr(t, "-channel", flagID(chid), "-archive", dir); err == nil {
+		t.Fatalf("run with a broken off download succeeded:\n%s", out)
+	}
+	if _, err := os.Stat(name); err == nil {
+		t.Error("broken off download left the attachment file")
+	}
+	if _, err := os.Stat(name + ".part"); err == nil {
+		t.Error("broken off download left its temporary file")
+	}
+	if left := f.left(); len(left) != 1 {
+		t.Errorf("left %v, want the message", left)
+	}
+
+	f.run(t, "-channel", flagID(chid), "-archive", dir)
+	if b, err := os.ReadFile(name); err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("attachment not downloaded in full: %d bytes, %v", len(b), err)
+	}
+	if left := f.left(); len(left) != 0 {
+		t.Errorf("left %v", left)
+	}
+
+	// A file cut short, as older versions could leave behind, is downloaded
+	// again by -fetch-attachments.
+	if err := os.WriteFile(name, data[:10], 0600); err != nil {
+		t.Fatal(err)
+	}
+	f.run(t, "-archive", dir, "-fetch-attachments")
+	if b, err := os.ReadFile(name); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("attachment not fetched again in full: %d bytes, %v", len(b), err)
+	}
+}
+
+func TestUnrefreshableAttachment(t *testing.T) {
+	const gid, chid = 5, 10
+	f := newFakeDiscord(testMessage(testID(0), gid, chid, testSelf, "hello"))
+	// The attachment's URL expired, and fetching the message again for a
+	// fresh one fails.
+	f.attach(t, testID(0), "file.txt", []byte("attachment"))
+	delete(f.files, "file.txt")
+	dir := t.TempDir()
+	out := f.run(t, "-channel", flagID(chid), "-archive", dir)
+	checkSummary(t, out, "Deleted 0 messages, skipped 1 ")
+	if left := f.left(); len(left) != 1 {
+		t.Errorf("left %v, want the message held back", left)
+	}
+	var missing string
+	err := openArchive(t, dir).QueryRow("SELECT json_extract(json, '$.missing_attachments') FROM Message WHERE id = ?", testID(0)).Scan(&missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing != "[0]" {
+		t.Errorf("archived missing attachments %s, want [0]", missing)
+	}
+}
+
+func TestArchiveZip(t *testing.T) {
+	const gid, chid = 5, 10
+	f := newFakeDiscord(
+		testMessage(testID(0), gid, chid, testSelf, "first"),
+		testMessage(testID(1), gid, chid, testSelf, "second"),
+	)
+	f.attach(t, testID(1), "file.txt", []byte("attachment"))
+	name := filepath.Join(t.TempDir(), "archive.zip")
+	f.run(t, "-channel", flagID(chid), "-archive-zip", name)
+	if left := f.left(); len(left) != 0 {
+		t.Errorf("left %v", left)
+	}
+	want := []string{
+		"messages/" + testID(0).String(),
+		"attachments/5/10/" + testID(1).String() + ",0 file.txt",
+		"messages/" + testID(1).String(),
+	}
+	checkZip := func() {
+		t.Helper()
+		r, err := zip.OpenReader(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		var got []string
+		for _, zf := range r.File {
+			got = append(got, zf.Name)
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("zip has %q, want %q", got, want)
+		}
+	}
+	checkZip()
+
+	// An existing zip isn't overwritten.
+	if out, err := f.runErr(t, "-channel", flagID(chid), "-archive-zip", name); err == nil {
+		t.Errorf("run into an existing zip succeeded:\n%s", out)
+	}
+	checkZip()
+}
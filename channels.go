@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+)
+
+// guildChannels returns the channels of a guild that can contain messages,
+// including the text chats of voice and stage channels, its active threads
+// and the archived threads of every channel that the user can list: all
+// public ones, and the private ones they can manage or have joined.
+// Channels whose archived threads can't be listed are included without them.
+func guildChannels(c *api.Client, gid discord.GuildID) ([]discord.Channel, error) {
+	all, err := c.Channels(gid)
+	if err != nil {
+		return nil, err
+	}
+	active, err := c.ActiveThreads(gid)
+	if err != nil {
+		return nil, err
+	}
+	var chs []discord.Channel
+	for _, ch := range all {
+		if hasMessages(ch.Type) {
+			chs = append(chs, ch)
+		}
+		if !hasThreads(ch.Type) {
+			continue
+		}
+		chs = append(chs, archivedThreads(c, ch.ID)...)
+		if ch.Type == discord.GuildText {
+			chs = append(chs, privateArchivedThreads(c, ch.ID)...)
+		}
+	}
+	return append(chs, active.Threads...), nil
+}
+
+// forumPosts returns the active and public archived posts of the forum
+// channels of a guild.
+func forumPosts(c *api.Client, gid discord.GuildID) ([]discord.Channel, error) {
+	all, err := c.Channels(gid)
+	if err != nil {
+		return nil, err
+	}
+	active, err := c.ActiveThreads(gid)
+	if err != nil {
+		return nil, err
+	}
+	forums := make(map[discord.ChannelID]bool)
+	var posts []discord.Channel
+	for _, ch := range all {
+		if ch.Type != discord.GuildForum {
+			continue
+		}
+		forums[ch.ID] = true
+		posts = append(posts, archivedThreads(c, ch.ID)...)
+	}
+	for _, th := range active.Threads {
+		if forums[th.ParentID] {
+			posts = append(posts, th)
+		}
+	}
+	return posts, nil
+}
+
+// guildThreads returns the active threads of a guild and the archived
+// threads of every channel that the user can list, as guildChannels does.
+func guildThreads(c *api.Client, gid discord.GuildID) ([]discord.Channel, error) {
+	all, err := c.Channels(gid)
+	if err != nil {
+		return nil, err
+	}
+	active, err := c.ActiveThreads(gid)
+	if err != nil {
+		return nil, err
+	}
+	var threads []discord.Channel
+	for _, ch := range all {
+		if hasThreads(ch.Type) {
+			threads = append(threads, archivedThreads(c, ch.ID)...)
+		}
+		if ch.Type == discord.GuildText {
+			threads = append(threads, privateArchivedThreads(c, ch.ID)...)
+		}
+	}
+	return append(threads, active.Threads...), nil
+}
+
+// privateChannels returns the open DMs and group DMs of the user, along
+// with those listed in index, if it isn't empty. index is the
+// messages/index.json file of a Discord data package, which maps the IDs of
+// every channel the user has written in to their names; the channels in it
+// that are no longer accessible are left out.
+func privateChannels(c *api.Client, index string) ([]discord.Channel, error) {
+	chs, err := c.PrivateChannels()
+	if err != nil {
+		return nil, err
+	}
+	if index == "" {
+		return chs, nil
+	}
+	b, err := os.ReadFile(index)
+	if err != nil {
+		return nil, err
+	}
+	var names map[discord.ChannelID]string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return nil, fmt.Errorf("reading data package index: %w", err)
+	}
+	seen := make(map[discord.ChannelID]bool, len(chs))
+	for _, ch := range chs {
+		seen[ch.ID] = true
+	}
+	ids := make([]discord.ChannelID, 0, len(names))
+	for id := range names {
+		if !seen[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		ch, err := c.Channel(id)
+		if err != nil {
+			continue
+		}
+		if ch.Type == discord.DirectMessage || ch.Type == discord.GroupDM {
+			chs = append(chs, *ch)
+		}
+	}
+	return chs, nil
+}
+
+// groupDMName returns the name of a group DM, or the names of its
+// recipients if it has none.
+func groupDMName(ch discord.Channel) string {
+	if ch.Name != "" {
+		return ch.Name
+	}
+	names := make([]string, len(ch.DMRecipients))
+	for i, u := range ch.DMRecipients {
+		names[i] = u.Username
+	}
+	return strings.Join(names, ", ")
+}
+
+// nsfwChannels returns the channels of a guild, as returned by
+// guildChannels, that are age-restricted or are threads of age-restricted
+// channels.
+func nsfwChannels(c *api.Client, gid discord.GuildID) ([]discord.Channel, error) {
+	all, err := c.Channels(gid)
+	if err != nil {
+		return nil, err
+	}
+	nsfw := make(map[discord.ChannelID]bool)
+	for _, ch := range all {
+		if ch.NSFW {
+			nsfw[ch.ID] = true
+		}
+	}
+	chs, err := guildChannels(c, gid)
+	if err != nil {
+		return nil, err
+	}
+	var restricted []discord.Channel
+	for _, ch := range chs {
+		if ch.NSFW || nsfw[ch.ID] || nsfw[ch.ParentID] {
+			restricted = append(restricted, ch)
+		}
+	}
+	return restricted, nil
+}
+
+// postsOf returns the active and public archived posts of a forum channel.
+func postsOf(c *api.Client, forum discord.Channel) ([]discord.Channel, error) {
+	active, err := c.ActiveThreads(forum.GuildID)
+	if err != nil {
+		return nil, err
+	}
+	posts := archivedThreads(c, forum.ID)
+	for _, th := range active.Threads {
+		if th.ParentID == forum.ID {
+			posts = append(posts, th)
+		}
+	}
+	return posts, nil
+}
+
+// archivedThreads returns the public archived threads of a channel, or as
+// many of them as could be listed.
+func archivedThreads(c *api.Client, chid discord.ChannelID) []discord.Channel {
+	var threads []discord.Channel
+	var before discord.Timestamp
+	for {
+		archived, err := c.PublicArchivedThreads(chid, before, 100)
+		if err != nil || len(archived.Threads) == 0 {
+			break
+		}
+		threads = append(threads, archived.Threads...)
+		if !archived.More {
+			break
+		}
+		before = archived.Threads[len(archived.Threads)-1].ThreadMetadata.ArchiveTimestamp
+	}
+	return threads
+}
+
+// privateArchivedThreads returns the private archived threads of a text
+// channel, or as many of them as could be listed. Listing all of them takes
+// the Manage Threads permission; without it, only those the user has joined
+// are returned.
+func privateArchivedThreads(c *api.Client, chid discord.ChannelID) []discord.Channel {
+	var threads []discord.Channel
+	var before discord.Timestamp
+	for {
+		archived, err := c.PrivateArchivedThreads(chid, before, 100)
+		if err != nil && threads == nil {
+			return joinedArchivedThreads(c, chid)
+		}
+		if err != nil || len(archived.Threads) == 0 {
+			break
+		}
+		threads = append(threads, archived.Threads...)
+		if !archived.More {
+			break
+		}
+		before = archived.Threads[len(archived.Threads)-1].ThreadMetadata.ArchiveTimestamp
+	}
+	return threads
+}
+
+// joinedArchivedThreads returns the private archived threads of a channel
+// that the user has joined, or as many of them as could be listed. They're
+// paged through by ID, which the API client can't do, since it only takes a
+// timestamp.
+func joinedArchivedThreads(c *api.Client, chid discord.ChannelID) []discord.Channel {
+	var threads []discord.Channel
+	var before discord.ChannelID
+	for {
+		query := url.Values{"limit": {"100"}}
+		if before.IsValid() {
+			query.Set("before", before.String())
+		}
+		var archived api.ArchivedThreads
+		err := c.RequestJSON(&archived, "GET",
+			api.EndpointChannels+chid.String()+"/users/@me/threads/archived/private",
+			func(r httpdriver.Request) error {
+				r.AddQuery(query)
+				return nil
+			})
+		if err != nil || len(archived.Threads) == 0 {
+			break
+		}
+		threads = append(threads, archived.Threads...)
+		if !archived.More {
+			break
+		}
+		before = archived.Threads[len(archived.Threads)-1].ID
+	}
+	return threads
+}
+
+// hasMessages reports whether channels of type t can contain messages.
+func hasMessages(t discord.ChannelType) bool {
+	switch t {
+	case discord.GuildText, discord.DirectMessage, discord.GuildVoice,
+		discord.GroupDM, discord.GuildAnnouncement,
+		discord.GuildAnnouncementThread, discord.GuildPublicThread,
+		discord.GuildPrivateThread, discord.GuildStageVoice:
+		return true
+	}
+	return false
+}
+
+// isThread reports whether channels of type t are threads.
+func isThread(t discord.ChannelType) bool {
+	switch t {
+	case discord.GuildAnnouncementThread, discord.GuildPublicThread, discord.GuildPrivateThread:
+		return true
+	}
+	return false
+}
+
+// hasThreads reports whether channels of type t can contain threads.
+func hasThreads(t discord.ChannelType) bool {
+	switch t {
+	case discord.GuildText, discord.GuildAnnouncement, discord.GuildForum:
+		return true
+	}
+	return false
+}
+
+// sortChannels sorts channels in place by the given order, which is either
+// "created" or "name".
+func sortChannels(chs []discord.Channel, order string) {
+	sort.SliceStable(chs, func(i, j int) bool {
+		if order == "name" && chs[i].Name != chs[j].Name {
+			return chs[i].Name < chs[j].Name
+		}
+		return chs[i].ID < chs[j].ID
+	})
+}
+
+// channelKinds are the kinds of channels that -channel-type accepts. The
+// voice kind covers the text chats of both voice and stage channels.
+var channelKinds = []string{"text", "voice", "thread", "forum-post"}
+
+// chanKinds resolves the kinds of channels, caching the channels fetched.
+type chanKinds struct {
+	// fetch fetches a channel. Without it, no channel can be resolved.
+	fetch func(discord.ChannelID) (*discord.Channel, error)
+	types map[discord.ChannelID]discord.Channel
+}
+
+func (k *chanKinds) channel(id discord.ChannelID) (discord.Channel, error) {
+	if ch, ok := k.types[id]; ok {
+		return ch, nil
+	}
+	if k.fetch == nil {
+		return discord.Channel{}, errors.New("channel types can't be resolved offline")
+	}
+	ch, err := k.fetch(id)
+	if err != nil {
+		return discord.Channel{}, err
+	}
+	if k.types == nil {
+		k.types = make(map[discord.ChannelID]discord.Channel)
+	}
+	k.types[id] = *ch
+	return *ch, nil
+}
+
+// kind returns one of channelKinds for a channel.
+func (k *chanKinds) kind(id discord.ChannelID) (string, error) {
+	ch, err := k.channel(id)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case ch.Type == discord.GuildVoice || ch.Type == discord.GuildStageVoice:
+		return "voice", nil
+	case isThread(ch.Type):
+		parent, err := k.channel(ch.ParentID)
+		if err != nil {
+			return "", err
+		}
+		if parent.Type == discord.GuildForum {
+			return "forum-post", nil
+		}
+		return "thread", nil
+	case ch.Type == discord.GuildText || ch.Type == discord.GuildAnnouncement ||
+		ch.Type == discord.DirectMessage || ch.Type == discord.GroupDM:
+		return "text", nil
+	}
+	return "", fmt.Errorf("channel %s has unknown type %d", id, ch.Type)
+}
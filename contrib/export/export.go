@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	archive := flag.String("a", "archive", "archive directory")
+	file := flag.String("messages-file", "messages", "name of the messages file in the archive directory")
+	out := flag.String("o", "export", "directory to write the channel files to")
+	flag.Parse()
+	names, err := channelNames(path.Join(*archive, "channels.json"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+path.Join(*archive, *file+".db")+"?mode=ro")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	if err := os.MkdirAll(*out, 0700); err != nil {
+		log.Fatalln(err)
+	}
+	// Messages come grouped by channel, so only one channel file is open at
+	// a time, however many channels the archive has.
+	rows, err := db.Query("SELECT channel, content, json FROM Message ORDER BY channel, id")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer rows.Close()
+	var (
+		f       *channelFile
+		current discord.ChannelID
+		n       int
+	)
+	for rows.Next() {
+		var (
+			channel discord.ChannelID
+			content string
+			jsonb   []byte
+		)
+		if err := rows.Scan(&channel, &content, &jsonb); err != nil {
+			log.Fatalln(err)
+		}
+		line, err := withContent(jsonb, content)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if f == nil || channel != current {
+			if f != nil {
+				if err := f.Close(); err != nil {
+					log.Fatalln(err)
+				}
+			}
+			f, err = createChannelFile(path.Join(*out, fileName(channel, names[channel])))
+			if err != nil {
+				log.Fatalln(err)
+			}
+			current = channel
+			n++
+		}
+		f.w.Write(line)
+		f.w.WriteByte('\n')
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalln(err)
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	log.Printf("Wrote %d channel files\n", n)
+}
+
+// channelNames reads the mapping of channel IDs to names in name, if it
+// exists.
+func channelNames(name string) (map[discord.ChannelID]string, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names map[discord.ChannelID]string
+	return names, json.Unmarshal(b, &names)
+}
+
+// fileName returns the name of the file of a channel, which includes the
+// channel's name if it's known.
+func fileName(id discord.ChannelID, name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' || r < ' ' {
+			return '-'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "channel-" + id.String() + ".jsonl"
+	}
+	return name + "-" + id.String() + ".jsonl"
+}
+
+// withContent puts content back into an archived message's JSON, keeping
+// any fields discord.Message doesn't know about.
+func withContent(jsonb []byte, content string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(jsonb, &fields); err != nil {
+		return nil, err
+	}
+	c, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	fields["content"] = c
+	return json.Marshal(fields)
+}
+
+type channelFile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func createChannelFile(name string) (*channelFile, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &channelFile{f, bufio.NewWriter(f)}, nil
+}
+
+func (f *channelFile) Close() error {
+	err := f.w.Flush()
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
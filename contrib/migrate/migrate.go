@@ -6,10 +6,12 @@ import (
 	"database/sql"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/diamondburned/arikawa/v3/discord"
 	sqlite3 "github.com/mattn/go-sqlite3"
@@ -24,55 +26,162 @@ CREATE TABLE IF NOT EXISTS Message (
 	content TEXT NOT NULL,
 	json TEXT NOT NULL
 );
+CREATE TABLE IF NOT EXISTS MessageEdit (
+	id INTEGER NOT NULL,
+	edited INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	json TEXT NOT NULL,
+	PRIMARY KEY (id, edited)
+);
+CREATE TABLE IF NOT EXISTS Attachment (
+	message INTEGER NOT NULL,
+	n INTEGER NOT NULL,
+	id INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	url TEXT NOT NULL,
+	path TEXT,
+	PRIMARY KEY (message, n)
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS MessageFTS USING fts4(content, content="Message");
+CREATE TABLE IF NOT EXISTS Stage (
+	name TEXT NOT NULL PRIMARY KEY
+);
 `
 
+// stages are the steps of the migration, in the order they are run. Each is
+// idempotent, and is skipped if it has already completed unless -force is
+// given.
+var stages = []struct {
+	name string
+	run  func(db *sql.DB, archive string) error
+}{
+	{"messages", importMessages},
+	{"attachments", indexAttachments},
+	{"fts", buildFTS},
+}
+
+// messagesFile is the name of the old messages file in the archive
+// directory. The database is named after it.
+var messagesFile = flag.String("messages-file", "messages", "name of the messages file in the archive directory")
+
 func main() {
 	archive := flag.String("a", "archive", "archive directory")
-	db, err := sql.Open("sqlite3", path.Join(*archive, "messages.db"))
+	only := flag.String("stages", "messages,attachments,fts", "comma-separated list of stages to run")
+	force := flag.Bool("force", false, "rerun stages that have already completed")
+	flag.Parse()
+	want := make(map[string]bool)
+	for _, s := range strings.Split(*only, ",") {
+		want[strings.TrimSpace(s)] = true
+	}
+	db, err := sql.Open("sqlite3", path.Join(*archive, *messagesFile+".db"))
 	if err != nil {
 		log.Fatalln(err)
 	}
-	_, err = db.Exec(schema)
-	in, err := os.Open(path.Join(*archive, "messages"))
-	if err != nil {
+	defer db.Close()
+	if _, err = db.Exec(schema); err != nil {
 		log.Fatalln(err)
 	}
+	for _, s := range stages {
+		if !want[s.name] {
+			continue
+		}
+		delete(want, s.name)
+		var done bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM Stage WHERE name = ?)", s.name).Scan(&done)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if done && !*force {
+			log.Printf("Skipping stage %s, already completed\n", s.name)
+			continue
+		}
+		log.Printf("Running stage %s\n", s.name)
+		if err := s.run(db, *archive); err != nil {
+			log.Fatalf("stage %s: %s\n", s.name, err)
+		}
+		if _, err := db.Exec("INSERT OR IGNORE INTO Stage (name) VALUES (?)", s.name); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	for s := range want {
+		log.Fatalf("unknown stage %q\n", s)
+	}
+}
+
+// archivedMessage is a line of the messages file. Its extra fields are kept
+// as they are. Redacted messages have empty content.
+type archivedMessage struct {
+	discord.Message
+	MissingAttachments []int  `json:"missing_attachments,omitempty"`
+	ContentSHA256      string `json:"content_sha256,omitempty"`
+}
+
+// importMessages imports the old line-based messages file into the Message
+// table. Later lines for an already imported message that differ from it are
+// imported into the MessageEdit table as edits.
+func importMessages(db *sql.DB, archive string) error {
+	in, err := os.Open(path.Join(archive, *messagesFile))
+	if err != nil {
+		return err
+	}
 	defer in.Close()
 	sc := bufio.NewScanner(in)
 	insert, err := db.Prepare("INSERT INTO Message (id, author, channel, guild, content, json) VALUES(?, ?, ?, ?, ?, ?)")
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	defer insert.Close()
-	doesExist, err := db.Prepare("SELECT EXISTS(SELECT 1 FROM Message WHERE id = ?)")
+	insertEdit, err := db.Prepare("INSERT OR IGNORE INTO MessageEdit (id, edited, content, json) VALUES(?, ?, ?, ?)")
 	if err != nil {
-		log.Fatalln(err)
+		return err
+	}
+	defer insertEdit.Close()
+	existing, err := db.Prepare("SELECT content, json FROM Message WHERE id = ?")
+	if err != nil {
+		return err
 	}
-	defer doesExist.Close()
+	defer existing.Close()
 	for sc.Scan() {
 		b := sc.Bytes()
 		snowflakes, jsonb, _ := bytes.Cut(b, []byte(" "))
 		splat := bytes.Split(snowflakes, []byte(","))
 		mid, _ := strconv.ParseInt(string(splat[2]), 10, 64)
-		_ = mid
-		var exists bool
-		err := doesExist.QueryRow(mid).Scan(&exists)
-		if exists {
-			continue
-		}
-		if err != nil {
-			log.Fatalln(err)
-		}
-		var msg discord.Message
+		var msg archivedMessage
 		err = json.Unmarshal(jsonb, &msg)
 		if err != nil {
-			log.Fatalln(err)
+			return err
 		}
 		content := msg.Content
 		msg.Content = ""
 		jsonb, err = json.Marshal(msg)
 		if err != nil {
-			log.Fatalln(err)
+			return err
+		}
+		var (
+			oldContent string
+			oldJSON    []byte
+		)
+		err := existing.QueryRow(mid).Scan(&oldContent, &oldJSON)
+		if err == nil {
+			var old discord.Message
+			if err := json.Unmarshal(oldJSON, &old); err != nil {
+				return err
+			}
+			if oldContent == content && old.EditedTimestamp == msg.EditedTimestamp {
+				continue
+			}
+			var edited int64
+			if msg.EditedTimestamp.IsValid() {
+				edited = msg.EditedTimestamp.Time().UnixMilli()
+			}
+			if _, err := insertEdit.Exec(mid, edited, content, jsonb); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
 		}
 		guildID := sql.NullInt64{
 			Int64: int64(msg.GuildID),
@@ -80,11 +189,73 @@ func main() {
 		}
 		if _, err := insert.Exec(msg.ID, msg.Author.ID, msg.ChannelID, guildID, content, jsonb); err != nil {
 			if e, ok := err.(sqlite3.Error); !ok || e.Code != sqlite3.ErrConstraint {
-				log.Fatalln(err)
+				return err
 			}
 		}
 	}
-	if err := sc.Err(); err != nil {
-		log.Fatalln(err)
+	return sc.Err()
+}
+
+// indexAttachments records the attachments of every archived message in the
+// Attachment table, along with the path of the downloaded file if there is
+// one. Files are only checked for existence, never read.
+func indexAttachments(db *sql.DB, archive string) error {
+	rows, err := db.Query("SELECT json FROM Message")
+	if err != nil {
+		return err
+	}
+	var msgs []discord.Message
+	for rows.Next() {
+		var jsonb []byte
+		if err := rows.Scan(&jsonb); err != nil {
+			rows.Close()
+			return err
+		}
+		var msg discord.Message
+		if err := json.Unmarshal(jsonb, &msg); err != nil {
+			rows.Close()
+			return err
+		}
+		if len(msg.Attachments) > 0 {
+			msgs = append(msgs, msg)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insert, err := tx.Prepare("INSERT OR IGNORE INTO Attachment (message, n, id, filename, size, url, path) VALUES(?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
 	}
+	defer insert.Close()
+	for _, msg := range msgs {
+		guild := "dm"
+		if msg.GuildID.IsValid() {
+			guild = msg.GuildID.String()
+		}
+		for n, att := range msg.Attachments {
+			var p sql.NullString
+			attf := path.Join("attachments", guild, msg.ChannelID.String(),
+				fmt.Sprintf("%d,%d %s", msg.ID, n, att.Filename))
+			if _, err := os.Stat(path.Join(archive, attf)); err == nil {
+				p = sql.NullString{String: attf, Valid: true}
+			}
+			if _, err := insert.Exec(msg.ID, n, att.ID, att.Filename, att.Size, att.URL, p); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// buildFTS rebuilds the full-text index over message contents.
+func buildFTS(db *sql.DB, archive string) error {
+	_, err := db.Exec("INSERT INTO MessageFTS(MessageFTS) VALUES('rebuild')")
+	return err
 }
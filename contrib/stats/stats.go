@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	archive := flag.String("a", "archive", "archive directory")
+	file := flag.String("messages-file", "messages", "name of the messages file in the archive directory")
+	top := flag.Int("top", 20, "number of top words to print")
+	flag.Parse()
+	db, err := sql.Open("sqlite3", "file:"+path.Join(*archive, *file+".db")+"?mode=ro")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT id, channel, content, json FROM Message")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer rows.Close()
+	var (
+		total    int
+		atts     int
+		attBytes uint64
+		channels = make(map[string]int)
+		months   = make(map[string]int)
+		words    = make(map[string]int)
+	)
+	for rows.Next() {
+		var (
+			id      discord.MessageID
+			channel discord.ChannelID
+			content string
+			jsonb   []byte
+		)
+		if err := rows.Scan(&id, &channel, &content, &jsonb); err != nil {
+			log.Fatalln(err)
+		}
+		var msg discord.Message
+		if err := json.Unmarshal(jsonb, &msg); err != nil {
+			log.Fatalln(err)
+		}
+		total++
+		channels[channel.String()]++
+		months[id.Time().UTC().Format("2006-01")]++
+		for _, w := range strings.FieldsFunc(strings.ToLower(content), isSeparator) {
+			words[w]++
+		}
+		for _, att := range msg.Attachments {
+			atts++
+			attBytes += att.Size
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalln(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "messages\t%d\n", total)
+	fmt.Fprintf(w, "attachments\t%d\n", atts)
+	fmt.Fprintf(w, "attachment bytes\t%d\n", attBytes)
+
+	fmt.Fprintln(w, "\nchannel\tmessages")
+	for _, kv := range sortCounts(channels) {
+		fmt.Fprintf(w, "%s\t%d\n", kv.key, kv.n)
+	}
+
+	fmt.Fprintln(w, "\nmonth\tmessages")
+	ms := make([]string, 0, len(months))
+	for m := range months {
+		ms = append(ms, m)
+	}
+	sort.Strings(ms)
+	for _, m := range ms {
+		fmt.Fprintf(w, "%s\t%d\n", m, months[m])
+	}
+
+	fmt.Fprintln(w, "\nword\tcount")
+	for i, kv := range sortCounts(words) {
+		if i == *top {
+			break
+		}
+		fmt.Fprintf(w, "%s\t%d\n", kv.key, kv.n)
+	}
+	w.Flush()
+}
+
+type count struct {
+	key string
+	n   int
+}
+
+// sortCounts returns the entries of m ordered by descending count.
+func sortCounts(m map[string]int) []count {
+	counts := make([]count, 0, len(m))
+	for k, n := range m {
+		counts = append(counts, count{k, n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].n != counts[j].n {
+			return counts[i].n > counts[j].n
+		}
+		return counts[i].key < counts[j].key
+	})
+	return counts
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// packageChannel is a channel of the messages directory of a Discord data
+// package, with the user's messages in it, oldest first.
+type packageChannel struct {
+	id       discord.ChannelID
+	guildID  discord.GuildID
+	messages []packageMessage
+}
+
+// packageMessage is a message of a data package.
+type packageMessage struct {
+	id       discord.MessageID
+	contents string
+	// attachments are the space-separated URLs of the attachments.
+	attachments string
+}
+
+// readDataPackage reads the channels of the data package in dir, which is
+// either the package itself or its messages directory. Each channel has a
+// directory holding a channel.json file, and the user's messages in either
+// messages.json or messages.csv. It fails if there are none, as when dir is
+// the wrong directory.
+func readDataPackage(dir string) ([]packageChannel, error) {
+	if fi, err := os.Stat(path.Join(dir, "messages")); err == nil && fi.IsDir() {
+		dir = path.Join(dir, "messages")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var chs []packageChannel
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		chdir := path.Join(dir, e.Name())
+		ch, err := readPackageChannel(chdir)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: skipping %s, it isn't a channel directory\n", chdir)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", chdir, err)
+		}
+		chs = append(chs, ch)
+	}
+	if len(chs) == 0 {
+		return nil, fmt.Errorf("no channel directories found in %s", dir)
+	}
+	return chs, nil
+}
+
+// readPackageChannel reads the channel directory dir of a data package.
+func readPackageChannel(dir string) (packageChannel, error) {
+	var ch packageChannel
+	b, err := os.ReadFile(path.Join(dir, "channel.json"))
+	if err != nil {
+		return ch, err
+	}
+	var info struct {
+		ID    discord.ChannelID `json:"id"`
+		Guild *struct {
+			ID discord.GuildID `json:"id"`
+		} `json:"guild"`
+	}
+	if err := json.Unmarshal(b, &info); err != nil {
+		return ch, fmt.Errorf("reading channel.json: %w", err)
+	}
+	ch.id = info.ID
+	if info.Guild != nil {
+		ch.guildID = info.Guild.ID
+	}
+	ch.messages, err = readPackageMessagesJSON(path.Join(dir, "messages.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		ch.messages, err = readPackageMessagesCSV(path.Join(dir, "messages.csv"))
+	}
+	if err != nil {
+		return ch, err
+	}
+	sort.Slice(ch.messages, func(i, j int) bool { return ch.messages[i].id < ch.messages[j].id })
+	return ch, nil
+}
+
+// readPackageMessagesJSON reads the messages of a messages.json file, a list
+// of objects whose ID field is a number or a string.
+func readPackageMessagesJSON(name string) ([]packageMessage, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []struct {
+		ID          json.Number `json:"ID"`
+		Contents    string      `json:"Contents"`
+		Attachments string      `json:"Attachments"`
+	}
+	if err := json.Unmarshal(b, &msgs); err != nil {
+		return nil, fmt.Errorf("reading messages.json: %w", err)
+	}
+	pms := make([]packageMessage, 0, len(msgs))
+	for _, m := range msgs {
+		id, err := discord.ParseSnowflake(m.ID.String())
+		if err != nil {
+			return nil, fmt.Errorf("reading messages.json: %w", err)
+		}
+		pms = append(pms, packageMessage{discord.MessageID(id), m.Contents, m.Attachments})
+	}
+	return pms, nil
+}
+
+// readPackageMessagesCSV reads the messages of a messages.csv file, by the
+// names of its header's columns.
+func readPackageMessagesCSV(name string) ([]packageMessage, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading messages.csv: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[name] = i
+	}
+	idCol, ok := cols["ID"]
+	if !ok {
+		return nil, errors.New("messages.csv has no ID column")
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return rec[i]
+		}
+		return ""
+	}
+	var pms []packageMessage
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return pms, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading messages.csv: %w", err)
+		}
+		if idCol >= len(rec) {
+			continue
+		}
+		id, err := discord.ParseSnowflake(rec[idCol])
+		if err != nil {
+			return nil, fmt.Errorf("reading messages.csv: %w", err)
+		}
+		pms = append(pms, packageMessage{discord.MessageID(id), field(rec, "Contents"), field(rec, "Attachments")})
+	}
+}
+
+// purgePackage deletes the messages listed in the channels of a data
+// package. Channels that are no longer accessible are skipped along with
+// their messages.
+func (d *deleter) purgePackage(ctx context.Context, chs []packageChannel, only, skip snowflakes) error {
+	guilds := make(map[discord.ChannelID]discord.GuildID)
+	for _, ch := range chs {
+		if len(ch.messages) == 0 {
+			continue
+		}
+		if !guildAllowed(ch.guildID, only, skip) {
+			log.Printf("Skipping %s\n", chanURL(ch.guildID, ch.id))
+			continue
+		}
+		fetched, err := d.c.Channel(ch.id)
+		if err != nil {
+			d.stats.skipped += uint(len(ch.messages))
+			log.Printf("Skipping %s and its %d messages, it's no longer accessible: %s\n", chanURL(ch.guildID, ch.id), len(ch.messages), err)
+			continue
+		}
+		guilds[ch.id] = fetched.GuildID
+		log.Printf("%s: %d messages listed.\n", chanURL(fetched.GuildID, ch.id), len(ch.messages))
+		for _, pm := range ch.messages {
+			m := discord.Message{ID: pm.id, ChannelID: ch.id, GuildID: fetched.GuildID}
+			if err := d.purgeListed(ctx, m, guilds, only, skip); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readPackageUser returns the ID of the user whose data package is in dir,
+// from its account/user.json file. Without it, the author of the messages
+// isn't known, so it's an error for it to be missing.
+func readPackageUser(dir string) (discord.UserID, error) {
+	b, err := os.ReadFile(path.Join(dir, "account", "user.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("%s has no account/user.json telling whose messages it holds; give the top directory of the data package", dir)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var u struct {
+		ID discord.UserID `json:"id"`
+	}
+	if err := json.Unmarshal(b, &u); err != nil {
+		return 0, fmt.Errorf("reading user.json: %w", err)
+	}
+	if !u.ID.IsValid() {
+		return 0, errors.New("user.json has no user ID")
+	}
+	return u.ID, nil
+}
+
+// importPackage adds the messages of a data package, sent by the user self,
+// to the archive, leaving alone those already in it. Their attachments are
+// only recorded, since their URLs have usually expired by then;
+// -fetch-attachments can download them later. It returns how many messages
+// were added.
+func importPackage(o *output, chs []packageChannel, self discord.UserID) (int, error) {
+	var before, after int
+	if err := o.QueryRow("SELECT COUNT(*) FROM Message").Scan(&before); err != nil {
+		return 0, err
+	}
+	noAttachments, trackEdits := o.noAttachments, o.trackEdits
+	o.noAttachments, o.trackEdits = true, false
+	defer func() { o.noAttachments, o.trackEdits = noAttachments, trackEdits }()
+	for _, ch := range chs {
+		for _, pm := range ch.messages {
+			m := discord.Message{
+				ID:        pm.id,
+				ChannelID: ch.id,
+				GuildID:   ch.guildID,
+				Author:    discord.User{ID: self},
+				Content:   pm.contents,
+				Timestamp: discord.NewTimestamp(pm.id.Time()),
+			}
+			for _, link := range strings.Fields(pm.attachments) {
+				m.Attachments = append(m.Attachments, packageAttachment(link))
+			}
+			if err := o.logMessage(m); err != nil {
+				return 0, fmt.Errorf("archiving %s: %w", m.URL(), err)
+			}
+		}
+	}
+	if err := o.QueryRow("SELECT COUNT(*) FROM Message").Scan(&after); err != nil {
+		return 0, err
+	}
+	return after - before, nil
+}
+
+// packageAttachment makes an attachment out of its URL in a data package,
+// which ends with its ID and file name.
+func packageAttachment(rawURL string) discord.Attachment {
+	att := discord.Attachment{URL: rawURL, Proxy: rawURL}
+	if u, err := url.Parse(rawURL); err == nil {
+		dir, name := path.Split(u.Path)
+		att.Filename = name
+		if id, err := discord.ParseSnowflake(path.Base(dir)); err == nil {
+			att.ID = discord.AttachmentID(id)
+		}
+	}
+	return att
+}
@@ -1,9 +1,8 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"database/sql"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -12,7 +11,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/diamondburned/arikawa/v3/api"
@@ -20,249 +21,1718 @@ import (
 	"github.com/diamondburned/arikawa/v3/gateway"
 	"github.com/diamondburned/arikawa/v3/session"
 	"github.com/diamondburned/arikawa/v3/utils/httputil"
-	"github.com/mattn/go-sqlite3"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
 )
 
 const (
+	UnknownChannel                 httputil.ErrorCode = 10003
 	UnknownMessage                 httputil.ErrorCode = 10008
+	MissingPermissions             httputil.ErrorCode = 50013
 	SystemMessageActionUnavailable httputil.ErrorCode = 50021
 	InvalidActionOnArchivedThread  httputil.ErrorCode = 50083
 )
 
 func main() {
+	var err error
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == "wizard":
+		err = wizard(os.Args[2:])
+	case len(os.Args) > 1 && os.Args[1] == "restore":
+		err = restore(os.Args[2:])
+	default:
+		err = run()
+	}
+	var cerr configError
+	if errors.As(err, &cerr) {
+		flag.Usage()
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	os.Exit(exitCode(err))
+}
+
+func run() error {
 	token := flag.String("token", "", "Discord user token")
-	chid := flag.Uint64("channel", 0, "Discord channel ID")
-	gid := flag.Uint64("guild", 0, "Discord guild ID")
+	var channels snowflakes
+	flag.Var(&channels, "channel", "Comma-separated list of Discord channel IDs, purged one after another; may be repeated")
+	var threads snowflakes
+	flag.Var(&threads, "thread", "Comma-separated list of thread IDs, purged one after another without their parent channels; may be repeated")
+	var forumIDs snowflakes
+	flag.Var(&forumIDs, "forum", "Comma-separated list of forum channel IDs whose active and archived posts are purged one after another; may be repeated")
+	deleteOwnPosts := flag.Bool("delete-own-posts", false, "Delete the forum posts you started once all of your messages in them are deleted, along with everyone else's replies")
+	var dmWithUsers snowflakes
+	flag.Var(&dmWithUsers, "dm-with", "Comma-separated list of user IDs whose DMs are purged, even if they were closed; may be repeated")
+	targetsFile := flag.String("targets", "", "File listing guild IDs, channel IDs and channel or message links to purge one after another, one per line, each optionally followed by filter flags and -archive=false applying to it alone")
+	var guilds snowflakes
+	flag.Var(&guilds, "guild", "Comma-separated list of Discord guild IDs, purged one after another after the channels; may be repeated")
 	archive := flag.String("archive", "./archive", "Directory to log deleted messages in")
+	apiBase := flag.String("api-base", "", "Send API requests to this base URL instead of https://discord.com")
+	unpin := flag.Bool("unpin", false, "Unpin pinned messages before deleting them; in guilds, this needs the Manage Messages permission, without which they're deleted still pinned")
+	scrubEdit := flag.Bool("scrub-edit", false, "Edit each message to -scrub-text, removing its attachments and embeds, before deleting it")
+	scrubText := flag.String("scrub-text", "\u200B", "Content messages are edited to with -scrub-edit")
+	unarchiveText := flag.String("unarchive-text", "\u200B", "Content of the message sent to unarchive a thread before deleting from it")
+	noUnarchive := flag.Bool("no-unarchive", false, "Skip messages in archived threads instead of sending a message to unarchive them")
+	archiveZip := flag.String("archive-zip", "", "Archive messages and attachments into this new zip file instead of the -archive directory")
+	archiveFile := flag.String("archive-file", "messages", "Name of the message log in the archive directory, without its .db extension")
+	instance := flag.String("instance", "", "Name of this instance, to keep a separate archive database from other instances sharing the archive directory")
+	dirMode, fileMode := fileMode(0700), fileMode(0600)
+	flag.Var(&dirMode, "archive-dir-mode", "Permissions of directories created in the archive, in octal")
+	flag.Var(&fileMode, "archive-mode", "Permissions of files created in the archive, in octal")
+	verifyArchive := flag.Bool("after-archive-verify", true, "Only delete messages once they and their attachments are confirmed to be in the archive")
+	redactArchive := flag.Bool("redact-archive", false, "Archive the SHA-256 hash of message contents instead of the contents, and leave out embed descriptions")
+	trackEdits := flag.Bool("track-edits", false, "Archive edited versions of already archived messages as separate records")
+	delay := flag.Duration("delay", 0, "Initial delay between deletions, which grows when rate limited and shrinks back after a streak of successes")
+	maxDelay := flag.Duration("max-delay", 30*time.Second, "Longest delay between deletions")
+	dryRun := flag.Bool("dry-run", false, "Search, filter and archive as usual, but only print the messages that would be deleted instead of deleting them")
+	reactions := flag.Bool("reactions", false, "Instead of deleting messages, remove your reactions in the targets, going through the whole history of their channels since search can't find reactions; only -after, -before and -exclude-channels apply")
+	estimateOnly := flag.Bool("estimate", false, "Search and report how many messages would be deleted, their attachments' size, a breakdown per channel and how long deleting them would take, without archiving or deleting anything")
+	archiveOnly := flag.Bool("archive-only", false, "Archive the messages search finds, with their attachments, without deleting anything")
+	limit := flag.Uint("limit", 0, "Stop after deleting this many messages, printing the last one deleted so a later run can resume with -min-id")
+	maxETA := flag.Duration("max-eta", 0, "Refuse to start on a target estimated to take longer than this")
+	force := flag.Bool("force", false, "Go ahead even if a target is estimated to take longer than -max-eta")
+	channelTimeout := flag.Duration("per-channel-timeout", 0, "In guild mode, move on to the next channel after working on one for this long, and come back to it at the end")
+	noGateway := flag.Bool("no-gateway", false, "Don't connect to the gateway, only use the REST API; this disables pausing while you're sending messages")
+	keepWithoutGateway := flag.Bool("keep-without-gateway", false, "Keep deleting without pausing when the gateway connection is lost for good, instead of stopping")
+	verbose := flag.Bool("verbose", false, "Log the full content of messages instead of a preview")
+	noContentLog := flag.Bool("no-content-log", false, "Never log message content")
+	eventsName := flag.String("events", "", "Write progress events as newline-delimited JSON to this file, or - for stderr")
+	forums := flag.Bool("forum-posts", false, "In guild mode, also search each active and archived forum post on its own")
+	channelOrder := flag.String("channel-order", "search", "In guild mode, either search the whole guild at once (search), or each channel in order of creation (created) or name (name)")
+	allGuilds := flag.Bool("all-guilds", false, "Purge every guild you're in, after confirming the list of them")
+	var excludeGuilds snowflakes
+	flag.Var(&excludeGuilds, "exclude-guilds", "With -all-guilds, comma-separated list of guild IDs to leave out; may be repeated")
+	yes := flag.Bool("yes", false, "Don't ask for confirmation before purging every guild with -all-guilds, before the deletion phase of -two-phase, or before leaving guilds with -leave-after")
+	twoPhase := flag.Bool("two-phase", false, "Archive every message to delete first, then print a summary of them and ask for confirmation before deleting them")
+	allDMs := flag.Bool("all-dms", false, "Purge every open DM and group DM")
+	allGroupDMs := flag.Bool("all-group-dms", false, "Purge every open group DM")
+	leaveAfter := flag.Bool("leave-after", false, "Leave each guild purged once search finds none of your messages left in it and none failed to be deleted, after confirming the list of them")
+	closeDMs := flag.Bool("close-dms", false, "Close each DM purged once all of your messages in it are deleted; group DMs can only be left, with -leave-groups")
+	leaveGroups := flag.Bool("leave-groups", false, "Leave each group DM purged once all of your messages in it are deleted")
+	dmsIndex := flag.String("dms-index", "", "With -all-dms, also purge the DMs listed in this messages/index.json file of a Discord data package")
+	var onlyGuilds, skipGuilds snowflakes
+	flag.Var(&onlyGuilds, "only-guilds", "Comma-separated list of the only guild IDs that may be touched")
+	flag.Var(&skipGuilds, "skip-guilds", "Comma-separated list of guild IDs that must never be touched")
+	nsfwOnly := flag.Bool("nsfw-only", false, "Only search the age-restricted channels, and their threads, each on its own")
+	threadsOnly := flag.Bool("threads-only", false, "Only search threads, active and archived, each on its own, leaving the messages of their parent channels alone")
+	var onlyChannels snowflakes
+	flag.Var(&onlyChannels, "only-channels", "In guild mode, comma-separated list of the only channel IDs to search, each on its own")
+	diffArchive := flag.Bool("diff-archive", false, "Compare the messages search finds with the archive, without archiving or deleting anything")
+	dumpSearch := flag.Bool("dump-search", false, "Write every raw search results page to the search-dumps directory, for debugging")
+	hasFlag := flag.String("has", "", "Only search for messages with all of these comma-separated kinds of content: "+strings.Join(searchHas, ", "))
+	paginationName := flag.String("pagination", "cursor", "How to page through search results: by the cursor Discord returns, falling back to message IDs (cursor), or by message IDs only (id)")
+	archiveTypes := flag.String("archive-types", "", "Only download attachments of these comma-separated types into the archive, and only record the others: "+strings.Join(attachmentTypes, ", "))
+	noAttachments := flag.Bool("no-attachments", false, "Don't download attachments, only record them in the archive")
+	fetchAttachments := flag.Bool("fetch-attachments", false, "Download the attachments of archived messages that are missing from the archive, without searching or deleting anything")
+	stdin := flag.Bool("stdin", false, "Instead of searching, delete the messages read from standard input as JSON lines, in the format of the archive's messages file")
+	fromArchive := flag.Bool("from-archive", false, "Instead of searching, delete your messages recorded in the -archive database, such as after -archive-only; the messages of a zip archive can be given to -stdin instead, with unzip -p archive.zip 'messages/*'")
+	dataPackage := flag.String("data-package", "", "Instead of searching, delete the messages listed in this Discord data package directory, channel by channel, archiving them first; channels no longer accessible are skipped")
+	selectFile := flag.String("select", "", "Instead of searching, delete the messages whose links or IDs are listed in this file, one per line, archiving them first; bare IDs are looked up in -channel")
+	preflight := flag.Bool("preflight", false, "Check the token, gateway, targets, archive and flags, without searching or deleting anything")
+	importPackageDir := flag.String("import-package", "", "Add the messages of this Discord data package directory to the archive, without connecting to Discord; their attachments are only recorded")
+	checkArchive := flag.Bool("check-archive", false, "Print which archived messages the filters would delete, without connecting to Discord")
+	var pf policyFlags
+	pf.register(flag.CommandLine)
 	flag.Parse()
-	if *chid == 0 && *gid == 0 {
-		flag.Usage()
-		log.Fatalln("at least one of -channel and -guild must be specified")
+	checks := checklist(*preflight)
+	policy, err := pf.policy()
+	if err != nil {
+		return configError{err.Error()}
 	}
-	if *token == "" {
-		flag.Usage()
-		log.Fatalln("-token option must be specified")
+	checks.ok("filters are valid")
+	var has []string
+	if *hasFlag != "" {
+		for _, h := range strings.Split(*hasFlag, ",") {
+			h = strings.TrimSpace(h)
+			if !contains(searchHas, h) {
+				return configErrorf("invalid -has %q, must be one of %s", h, strings.Join(searchHas, ", "))
+			}
+			has = append(has, h)
+		}
+	}
+	var attTypes []string
+	if *archiveTypes != "" {
+		for _, t := range strings.Split(*archiveTypes, ",") {
+			t = strings.TrimSpace(t)
+			if !contains(attachmentTypes, t) {
+				return configErrorf("invalid -archive-types %q, must be one of %s", t, strings.Join(attachmentTypes, ", "))
+			}
+			attTypes = append(attTypes, t)
+		}
+	}
+	paginate, ok := paginations[*paginationName]
+	if !ok {
+		return configErrorf("-pagination must be one of cursor and id")
+	}
+	d := &deleter{
+		policy:             policy,
+		paginate:           paginate,
+		has:                has,
+		unarchiveText:      *unarchiveText,
+		noUnarchive:        *noUnarchive,
+		verbose:            *verbose,
+		noContentLog:       *noContentLog,
+		keepWithoutGateway: *keepWithoutGateway,
+		channelTimeout:     *channelTimeout,
+		verifyArchive:      *verifyArchive,
+		limit:              *limit,
+		dryRun:             *dryRun,
+		archiveOnly:        *archiveOnly,
+	}
+	if !*force {
+		d.maxETA = *maxETA
+	}
+	if *estimateOnly {
+		// Deletions take at least as long as a request, and at least the
+		// configured delay.
+		d.estimate = &estimate{pace: assumedDeleteTime}
+		if *delay > d.estimate.pace {
+			d.estimate.pace = *delay
+		}
 	}
 	var output *output
-	if *archive != "" {
-		var err error
-		output, err = newOutput(*archive)
+	switch {
+	case *archiveZip != "":
+		if *trackEdits || *checkArchive || *fetchAttachments || *diffArchive || *importPackageDir != "" || *fromArchive {
+			return configErrorf("-archive-zip doesn't support -track-edits, -check-archive, -fetch-attachments, -diff-archive, -import-package and -from-archive")
+		}
+		output, err = newZipOutput(*archiveZip, outputOptions{fileMode: os.FileMode(fileMode)})
+		if errors.Is(err, os.ErrExist) {
+			return configErrorf("-archive-zip %s already exists", *archiveZip)
+		}
+		if err != nil {
+			return fmt.Errorf("creating archive zip: %w", err)
+		}
+		defer func() {
+			if err := output.Close(); err != nil {
+				log.Println("Error while finishing archive zip:", err)
+			}
+		}()
+		output.noAttachments = *noAttachments
+		output.attachmentTypes = attTypes
+		output.redact = *redactArchive
+	case *archive != "":
+		output, err = newOutput(*archive, outputOptions{
+			file:     *archiveFile,
+			instance: *instance,
+			dirMode:  os.FileMode(dirMode),
+			fileMode: os.FileMode(fileMode),
+		})
 		if err != nil {
-			log.Fatalln("Error while opening archive directory:", err)
+			return fmt.Errorf("opening archive directory: %w", err)
 		}
 		defer output.Close()
+		output.trackEdits = *trackEdits
+		output.noAttachments = *noAttachments
+		output.attachmentTypes = attTypes
+		output.redact = *redactArchive
+	}
+	if output != nil {
+		checks.ok("archive is writable")
+	}
+	if *dumpSearch {
+		d.dumps, err = newSearchDumps("search-dumps", os.FileMode(dirMode), os.FileMode(fileMode))
+		if err != nil {
+			return fmt.Errorf("creating search dumps directory: %w", err)
+		}
+	}
+	if *archiveOnly && output == nil {
+		return configErrorf("-archive-only requires -archive or -archive-zip")
+	}
+	if (*archiveOnly && *dryRun) || (*estimateOnly && (*archiveOnly || *dryRun)) {
+		return configErrorf("-archive-only, -dry-run and -estimate can't be combined")
+	}
+	if *twoPhase {
+		switch {
+		case output == nil:
+			return configErrorf("-two-phase requires -archive or -archive-zip")
+		case *archiveOnly || *dryRun || *estimateOnly:
+			return configErrorf("-two-phase can't be combined with -archive-only, -dry-run and -estimate")
+		case *leaveGroups || *deleteOwnPosts || *closeDMs || *leaveAfter:
+			return configErrorf("-two-phase can't be combined with -leave-groups, -delete-own-posts, -close-dms and -leave-after")
+		case *stdin || *selectFile != "" || *dataPackage != "" || *fromArchive:
+			return configErrorf("-two-phase can't be combined with -stdin, -select, -data-package and -from-archive")
+		}
+		d.hold = &holding{estimate: estimate{pace: assumedDeleteTime}}
+		if *delay > d.hold.pace {
+			d.hold.pace = *delay
+		}
+	}
+	if *preflight && (*checkArchive || *fetchAttachments || *diffArchive || *importPackageDir != "") {
+		return configErrorf("-preflight can't be combined with -check-archive, -fetch-attachments, -diff-archive and -import-package")
+	}
+	if *importPackageDir != "" {
+		if output == nil {
+			return configErrorf("-import-package requires -archive")
+		}
+		chs, err := readDataPackage(*importPackageDir)
+		if err != nil {
+			return configErrorf("reading -import-package: %s", err)
+		}
+		self, err := readPackageUser(*importPackageDir)
+		if err != nil {
+			return configErrorf("reading -import-package: %s", err)
+		}
+		var total int
+		for _, ch := range chs {
+			total += len(ch.messages)
+		}
+		n, err := importPackage(output, chs, self)
+		if err != nil {
+			return fmt.Errorf("importing data package: %w", err)
+		}
+		log.Printf("Imported %d messages from %d channels, %d were already archived.\n", n, len(chs), total-n)
+		return nil
+	}
+	if *checkArchive || *fetchAttachments {
+		if output == nil {
+			return configErrorf("-check-archive and -fetch-attachments require -archive")
+		}
+		if *checkArchive {
+			err = d.checkArchive(output)
+		} else {
+			if *token != "" {
+				client := api.NewClient(*token)
+				if err := setAPIBase(client, *apiBase); err != nil {
+					return configErrorf("invalid -api-base: %s", err)
+				}
+				output.refresh = client.Message
+			}
+			err = output.messages(func(m discord.Message) error {
+				_, err := output.saveAttachments(m)
+				return err
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+		return nil
+	}
+	switch {
+	case *stdin && (*targetsFile != "" || len(dmWithUsers) > 0 || len(channels) > 0 || len(threads) > 0 || len(forumIDs) > 0 || len(guilds) > 0 || *diffArchive):
+		return configErrorf("-stdin can't be combined with -channel, -thread, -forum, -guild, -targets, -dm-with and -diff-archive")
+	case *selectFile != "" && (*stdin || len(guilds) > 0 || *diffArchive || len(channels) > 1 || len(threads) > 0 || len(forumIDs) > 0 || *targetsFile != "" || len(dmWithUsers) > 0):
+		return configErrorf("-select can't be combined with -stdin, -guild, -diff-archive, -thread, -forum, -targets, -dm-with and several -channel")
+	case *fromArchive && (*stdin || *selectFile != "" || *dataPackage != "" || len(guilds) > 0 || *diffArchive || len(channels) > 0 || len(threads) > 0 || len(forumIDs) > 0 || *targetsFile != "" || len(dmWithUsers) > 0 || *allGuilds || *allDMs || *allGroupDMs):
+		return configErrorf("-from-archive can't be combined with other ways of picking messages, such as -stdin, -channel and -guild")
+	case *fromArchive && (output == nil || *archiveOnly):
+		return configErrorf("-from-archive requires -archive, and can't be combined with -archive-only")
+	case *reactions && (*stdin || *selectFile != "" || *dataPackage != "" || *fromArchive || *diffArchive || *archiveOnly || *estimateOnly || *twoPhase):
+		return configErrorf("-reactions can't be combined with -stdin, -select, -data-package, -from-archive, -diff-archive, -archive-only, -estimate and -two-phase")
+	case *dataPackage != "" && (*stdin || *selectFile != "" || len(guilds) > 0 || *diffArchive || len(channels) > 0 || len(threads) > 0 || len(forumIDs) > 0 || *targetsFile != "" || len(dmWithUsers) > 0):
+		return configErrorf("-data-package can't be combined with -stdin, -select, -guild, -diff-archive, -channel, -thread, -forum, -targets and -dm-with")
+	case pf.sample != "" && !strings.HasSuffix(pf.sample, "%") && (*stdin || *selectFile != "" || *dataPackage != "" || *fromArchive):
+		return configErrorf("-sample can only be a percentage with -stdin, -select, -data-package and -from-archive")
+	case len(excludeGuilds) > 0 && !*allGuilds:
+		return configErrorf("-exclude-guilds requires -all-guilds")
+	case *allGuilds && (*stdin || *selectFile != "" || len(guilds) > 0):
+		return configErrorf("-all-guilds can't be combined with -stdin, -select and -guild")
+	case (*allGuilds || *allDMs || *allGroupDMs) && *dataPackage != "":
+		return configErrorf("-all-guilds, -all-dms and -all-group-dms can't be combined with -data-package")
+	case (*allDMs || *allGroupDMs) && (*stdin || *selectFile != ""):
+		return configErrorf("-all-dms and -all-group-dms can't be combined with -stdin and -select")
+	case *allDMs && *allGroupDMs:
+		return configErrorf("-all-dms already includes -all-group-dms")
+	case *dmsIndex != "" && !*allDMs:
+		return configErrorf("-dms-index requires -all-dms")
+	case !*stdin && *selectFile == "" && *dataPackage == "" && !*fromArchive && !*allGuilds && !*allDMs && !*allGroupDMs && *targetsFile == "" && len(dmWithUsers) == 0 && len(channels) == 0 && len(threads) == 0 && len(forumIDs) == 0 && len(guilds) == 0:
+		return configErrorf("at least one of -channel, -thread, -forum, -guild, -targets, -dm-with, -all-guilds, -all-dms, -all-group-dms, -stdin, -select, -data-package and -from-archive must be specified")
+	}
+	if *token == "" {
+		return configErrorf("-token option must be specified")
+	}
+	switch *channelOrder {
+	case "search", "created", "name":
+	default:
+		return configErrorf("-channel-order must be one of search, created and name")
+	}
+	if *unarchiveText == "" {
+		return configErrorf("-unarchive-text must not be empty")
+	}
+	if *unpin {
+		if pf.skipPinned {
+			return configErrorf("-unpin and -skip-pinned can't be combined")
+		}
+		d.unpin = new(pinCache)
+	}
+	if *scrubEdit {
+		if *scrubText == "" {
+			return configErrorf("-scrub-text must not be empty")
+		}
+		d.scrubText = *scrubText
+	}
+	if mentionRe.MatchString(*unarchiveText) {
+		log.Println("Warning: -unarchive-text contains a mention, which will ping whoever it mentions")
+	}
+	checks.ok("flags are coherent")
+	var events *eventLog
+	if *eventsName != "" {
+		events, err = newEventLog(*eventsName, os.FileMode(fileMode))
+		if err != nil {
+			return fmt.Errorf("opening event log: %w", err)
+		}
+		defer events.Close()
 	}
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer cancel()
 	c := session.New(*token)
+	if err := setAPIBase(c.Client, *apiBase); err != nil {
+		return configErrorf("invalid -api-base: %s", err)
+	}
+	if output != nil {
+		output.refresh = c.Message
+	}
+	limits := newChanLimits()
+	pacer := newPacer(*delay, *maxDelay)
+	c.Client.Client.OnResponse = append(c.Client.Client.OnResponse, limits.onResponse, pacer.onResponse)
+	if *scrubEdit {
+		d.editLimits = newChanLimits()
+		d.editLimits.edits = true
+		d.editPacer = newPacer(*delay, *maxDelay)
+		d.editPacer.edits = true
+		c.Client.Client.OnResponse = append(c.Client.Client.OnResponse, d.editLimits.onResponse, d.editPacer.onResponse)
+	}
 	self, err := c.Me()
 	if err != nil {
-		log.Fatalln("Error fetching self:", err)
+		return fmt.Errorf("fetching self: %w", err)
 	}
+	checks.ok("token is valid, logged in as %s", self.Username)
+	// Without the gateway, pause and gatewayDead are never sent on, so the
+	// run never pauses.
 	pause := make(chan struct{})
-	c.AddHandler(func(m *gateway.MessageCreateEvent) {
-		if m.Author.ID == self.ID {
-			pause <- struct{}{}
+	var gatewayDead <-chan error
+	if !*noGateway {
+		c.AddHandler(func(m *gateway.MessageCreateEvent) {
+			if m.Author.ID == self.ID {
+				pause <- struct{}{}
+			}
+		})
+		gateway.DefaultGatewayOpts.ReconnectAttempt = gatewayAttempts
+		if err := c.Open(ctx); err != nil {
+			return fmt.Errorf("opening gateway: %w", err)
 		}
-	})
-	if err := c.Open(ctx); err != nil {
-		log.Fatalln(err)
+		defer c.Close()
+		checks.ok("gateway is connectable")
+		gatewayDead = watchGateway(ctx, c)
 	}
-	defer c.Close()
-	searchdata := api.SearchData{
-		SortBy:    "timestamp",
-		SortOrder: "asc",
-		AuthorID:  self.ID,
+	d.c = c
+	d.self = self.ID
+	d.output = output
+	d.limits = limits
+	d.pacer = pacer
+	d.pause = pause
+	d.gatewayDead = gatewayDead
+	d.events = events
+	d.connect(policy)
+	if *stdin {
+		if *preflight {
+			log.Println("Preflight checks passed")
+			return nil
+		}
+		d.start = time.Now()
+		return d.finish(d.purgeReader(ctx, os.Stdin, 0, onlyGuilds, skipGuilds))
 	}
-	var guildID discord.GuildID
-	if *chid != 0 {
-		chid := discord.ChannelID(*chid)
-		searchdata.ChannelID = chid
-		ch, err := c.Channel(chid)
+	if *selectFile != "" {
+		f, err := os.Open(*selectFile)
 		if err != nil {
-			log.Fatalln("Error while fetching channel: ", err)
+			return configErrorf("opening -select file: %s", err)
 		}
-		guildID = ch.GuildID
-	} else {
-		guildID = discord.GuildID(*gid)
-	}
-	now := time.Now()
-	var deleted uint = 0
-Outer:
-	for {
-		var results api.SearchResponse
-		if guildID.IsValid() {
-			results, err = c.Client.Search(guildID, searchdata)
-		} else {
-			results, err = c.Client.SearchDirectMessages(searchdata)
-		}
-		if err != nil {
-			log.Fatalln("Error occured while searching messages:", err)
-		}
-		log.Printf("%d messages remaining.\n", results.TotalResults)
-		if deleted > 0 {
-			log.Printf("Estimated remaining time: %s\n", time.Since(now)/time.Duration(deleted)*time.Duration(results.TotalResults))
-		}
-		if results.TotalResults == 0 {
-			break Outer
-		}
-		for _, result := range results.Messages {
-			for _, m := range result {
-			Inner:
-				select {
-				case <-pause:
-					timer := time.NewTimer(30 * time.Second)
-					for {
-						select {
-						case <-timer.C:
-							break Inner
-						case <-pause:
-							timer.Reset(30 * time.Second)
-						case <-ctx.Done():
-							break Outer
-						}
-					}
-				case <-ctx.Done():
-					break Outer
-				default:
-				}
-				m.GuildID = discord.GuildID(*gid)
-				if output != nil {
-					err := output.logMessage(m)
-					if err != nil {
-						log.Fatalf("Error logging message %s: %s\n", m.URL(), err)
-					}
-				}
-				if m.Author.ID != self.ID {
-					goto Continue
-				}
-				err = deleteMsg(c.Client, m)
-				if err != nil {
-					log.Printf("Error deleting %s: %s\n", m.URL(), err)
+		defer f.Close()
+		if *preflight {
+			log.Println("Preflight checks passed")
+			return nil
+		}
+		d.start = time.Now()
+		var chid discord.ChannelID
+		if len(channels) > 0 {
+			chid = discord.ChannelID(channels[0])
+		}
+		return d.finish(d.purgeReader(ctx, f, chid, onlyGuilds, skipGuilds))
+	}
+	if *fromArchive {
+		if *preflight {
+			log.Println("Preflight checks passed")
+			return nil
+		}
+		d.start = time.Now()
+		return d.finish(d.purgeArchived(ctx, output, onlyGuilds, skipGuilds))
+	}
+	if *dataPackage != "" {
+		chs, err := readDataPackage(*dataPackage)
+		if err != nil {
+			return configErrorf("reading -data-package: %s", err)
+		}
+		if *preflight {
+			log.Println("Preflight checks passed")
+			return nil
+		}
+		d.start = time.Now()
+		return d.finish(d.purgePackage(ctx, chs, onlyGuilds, skipGuilds))
+	}
+
+	var targets []target
+	for _, id := range channels {
+		ch, err := c.Channel(discord.ChannelID(id))
+		if err != nil {
+			return fmt.Errorf("fetching channel %s: %w", id, err)
+		}
+		if dmWith(*ch, pf.excludeUsers) {
+			log.Printf("Skipping %s, it's a DM with a user in -exclude-users\n", chanURL(ch.GuildID, ch.ID))
+			continue
+		}
+		t := target{guildID: ch.GuildID, channelID: ch.ID}
+		if ch.Type == discord.GroupDM {
+			t.groupDM = groupDMName(*ch)
+		}
+		targets = append(targets, t)
+	}
+	if *allDMs || *allGroupDMs {
+		dms, err := privateChannels(c.Client, *dmsIndex)
+		if err != nil {
+			return fmt.Errorf("fetching DMs: %w", err)
+		}
+		for _, ch := range dms {
+			if *allGroupDMs && ch.Type != discord.GroupDM {
+				continue
+			}
+			if dmWith(ch, pf.excludeUsers) {
+				log.Printf("Skipping %s, it's a DM with a user in -exclude-users\n", chanURL(ch.GuildID, ch.ID))
+				continue
+			}
+			t := target{channelID: ch.ID}
+			if ch.Type == discord.GroupDM {
+				t.groupDM = groupDMName(ch)
+			}
+			targets = append(targets, t)
+		}
+	}
+	for _, id := range dmWithUsers {
+		if pf.excludeUsers.contains(id) {
+			return configErrorf("user %s is both in -dm-with and -exclude-users", id)
+		}
+		// Creating a DM that already exists, even closed, returns it.
+		ch, err := c.CreatePrivateChannel(discord.UserID(id))
+		if err != nil {
+			return fmt.Errorf("opening DM with %s: %w", id, err)
+		}
+		targets = append(targets, target{channelID: ch.ID})
+	}
+	for _, id := range threads {
+		th, err := c.Channel(discord.ChannelID(id))
+		if err != nil {
+			return fmt.Errorf("fetching thread %s: %w", id, err)
+		}
+		if !isThread(th.Type) {
+			return configErrorf("%s isn't a thread", chanURL(th.GuildID, th.ID))
+		}
+		targets = append(targets, target{guildID: th.GuildID, channelID: th.ID})
+	}
+	for _, id := range forumIDs {
+		forum, err := c.Channel(discord.ChannelID(id))
+		if err != nil {
+			return fmt.Errorf("fetching forum %s: %w", id, err)
+		}
+		if forum.Type != discord.GuildForum {
+			return configErrorf("%s isn't a forum channel", chanURL(forum.GuildID, forum.ID))
+		}
+		posts, err := postsOf(c.Client, *forum)
+		if err != nil {
+			return fmt.Errorf("fetching posts of forum %s: %w", id, err)
+		}
+		for _, post := range posts {
+			targets = append(targets, target{
+				guildID:   forum.GuildID,
+				channelID: post.ID,
+				forumPost: true,
+				ownPost:   post.OwnerID == self.ID,
+			})
+		}
+	}
+	for _, id := range guilds {
+		targets = append(targets, target{guildID: discord.GuildID(id)})
+	}
+	if *targetsFile != "" {
+		listed, err := readTargets(c.Client, *targetsFile, pf, output != nil)
+		if err != nil {
+			return configErrorf("reading -targets: %s", err)
+		}
+		for _, t := range listed {
+			if t.policy != nil {
+				d.connect(t.policy)
+			}
+		}
+		targets = append(targets, listed...)
+	}
+	guildNames := make(map[discord.GuildID]string)
+	if *allGuilds {
+		gs, err := c.Guilds(0)
+		if err != nil {
+			return fmt.Errorf("fetching guilds: %w", err)
+		}
+		for _, g := range gs {
+			if excludeGuilds.contains(discord.Snowflake(g.ID)) {
+				log.Printf("Skipping guild %s (%s), it's in -exclude-guilds\n", g.Name, g.ID)
+				continue
+			}
+			guildNames[g.ID] = g.Name
+			targets = append(targets, target{guildID: g.ID})
+		}
+	}
+	if len(targets) == 0 {
+		return configErrorf("no targets left after applying -exclude-users and -exclude-guilds")
+	}
+	targets = filterGuilds(targets, onlyGuilds, skipGuilds)
+	if len(targets) == 0 {
+		return configErrorf("no targets left after applying -only-guilds and -skip-guilds")
+	}
+	if *allGuilds && !*yes && !*preflight {
+		fmt.Fprintln(os.Stderr, "Your messages will be deleted in these guilds:")
+		for _, t := range targets {
+			if !t.channelID.IsValid() {
+				fmt.Fprintf(os.Stderr, "  %s (%s)\n", guildNames[t.guildID], t.guildID)
+			}
+		}
+		ok, err := confirm(os.Stdin, "Go ahead?")
+		if err != nil {
+			return fmt.Errorf("reading confirmation: %w", err)
+		}
+		if !ok {
+			log.Println("Not confirmed, stopping")
+			return nil
+		}
+	}
+	if len(onlyChannels) > 0 {
+		targets, err = restrictChannels(c.Client, targets, onlyChannels)
+		if err != nil {
+			return fmt.Errorf("fetching -only-channels: %w", err)
+		}
+		if len(targets) == 0 {
+			return configErrorf("no targets left after applying -only-channels")
+		}
+	}
+	if *nsfwOnly {
+		targets, err = restrictNSFW(c.Client, targets)
+		if err != nil {
+			return fmt.Errorf("fetching age-restricted channels: %w", err)
+		}
+		if len(targets) == 0 {
+			return configErrorf("no age-restricted channels to search")
+		}
+	}
+	if *threadsOnly && pf.skipThreads {
+		return configErrorf("-threads-only and -skip-threads can't be used together")
+	}
+	if *threadsOnly {
+		targets, err = restrictThreads(c.Client, targets)
+		if err != nil {
+			return fmt.Errorf("fetching threads: %w", err)
+		}
+		if len(targets) == 0 {
+			return configErrorf("no threads to search")
+		}
+	}
+	if *channelOrder != "search" {
+		targets, err = splitGuilds(c.Client, targets, *channelOrder)
+		if err != nil {
+			return fmt.Errorf("fetching guild channels: %w", err)
+		}
+	}
+	if *forums {
+		targets, err = addForumPosts(c.Client, targets)
+		if err != nil {
+			return fmt.Errorf("fetching forum posts: %w", err)
+		}
+	}
+	targets = filterChannels(targets, pf.excludeChannels)
+	if len(targets) == 0 {
+		return configErrorf("no targets left after applying -exclude-channels")
+	}
+	log.Println("Targets:", targets)
+	if *preflight {
+		for _, t := range targets {
+			if t.channelID.IsValid() {
+				continue
+			}
+			if _, err := c.Guild(t.guildID); err != nil {
+				return fmt.Errorf("fetching guild: %w", err)
+			}
+		}
+		checks.ok("targets are accessible")
+		log.Println("Preflight checks passed")
+		return nil
+	}
+
+	if *diffArchive {
+		if output == nil {
+			return configErrorf("-diff-archive requires -archive")
+		}
+		if err := d.diffArchive(ctx, output, targets); err != nil {
+			return fmt.Errorf("comparing with archive: %w", err)
+		}
+		return nil
+	}
+	if !*reactions {
+		if err := d.countSamples(ctx, targets, policy); err != nil {
+			return d.finish(err)
+		}
+	}
+	d.start = time.Now()
+	// Report progress per guild when there are several.
+	var guildOrder []discord.GuildID
+	for _, t := range targets {
+		if len(guildOrder) == 0 || guildOrder[len(guildOrder)-1] != t.guildID {
+			guildOrder = append(guildOrder, t.guildID)
+		}
+	}
+	// Only runs that delete act on the targets once they're purged.
+	deletes := !d.dryRun && !d.archiveOnly && d.estimate == nil && d.hold == nil && !*reactions
+	// troubled holds the guilds where messages failed to be deleted or
+	// were skipped.
+	troubled := make(map[discord.GuildID]bool)
+	var guild discord.GuildID
+	for len(targets) > 0 {
+		t := targets[0]
+		targets = targets[1:]
+		if len(guildOrder) > 1 && t.guildID.IsValid() && t.guildID != guild {
+			guild = t.guildID
+			for i, gid := range guildOrder {
+				if gid == guild {
+					log.Printf("Working on guild %s (%d of %d)\n", guild, i+1, len(guildOrder))
+					break
 				}
-			Continue:
-				deleted++
-				searchdata.MinID = m.ID + 1
 			}
 		}
+		failed, kept := d.stats.failed+d.stats.skipped, d.stats.kept
+		d.policy, d.output = policy, output
+		if t.policy != nil {
+			d.policy = t.policy
+		}
+		if t.noArchive {
+			d.output = nil
+		}
+		resume := t.after
+		if *reactions {
+			err = d.unreact(ctx, t, pf.excludeChannels)
+		} else {
+			err = d.purge(ctx, &t)
+		}
+		if errors.Is(err, errChannelTimeout) {
+			// Only come back to targets that got somewhere, or a target
+			// that never does would be retried forever.
+			if t.after != resume {
+				log.Printf("Warning: %s took longer than -per-channel-timeout, coming back to it later\n", t)
+				targets = append(targets, t)
+				continue
+			}
+			log.Printf("Warning: %s took longer than -per-channel-timeout without getting anywhere, giving up on it\n", t)
+			d.stats.failed++
+			d.stats.addError(err)
+			troubled[t.guildID] = true
+			err = nil
+			continue
+		}
+		if err != nil {
+			break
+		}
+		if d.stats.failed+d.stats.skipped > failed {
+			troubled[t.guildID] = true
+		}
+		if !deletes {
+			continue
+		}
+		if *deleteOwnPosts && t.ownPost {
+			d.deleteOwnPost(t, d.stats.failed+d.stats.skipped > failed || d.stats.kept > kept)
+		}
+		if *leaveGroups && t.groupDM != "" {
+			if d.stats.failed+d.stats.skipped > failed {
+				log.Printf("Not leaving %s, some of your messages in it weren't deleted\n", t)
+			} else if err := c.DeleteChannel(t.channelID, ""); err != nil {
+				log.Printf("Error leaving %s: %s\n", t, err)
+			} else {
+				log.Printf("Left %s\n", t)
+			}
+		}
+		if *closeDMs && !t.guildID.IsValid() && t.channelID.IsValid() && !(*leaveGroups && t.groupDM != "") {
+			if d.stats.failed+d.stats.skipped > failed {
+				log.Printf("Not closing %s, some of your messages in it weren't deleted\n", t)
+			} else {
+				closeDM(c.Client, t)
+			}
+		}
+	}
+	if d.hold != nil && err == nil {
+		err = d.releaseHeld(ctx, *yes)
+	}
+	if *leaveAfter && deletes && err == nil {
+		var gids []discord.GuildID
+		for _, gid := range guildOrder {
+			switch {
+			case !gid.IsValid():
+			case troubled[gid]:
+				log.Printf("Not leaving guild %s, some of your messages in it weren't deleted\n", gid)
+			default:
+				gids = append(gids, gid)
+			}
+		}
+		err = d.leaveGuilds(gids, guildNames, *yes)
 	}
+	return d.finish(err)
 }
 
-const schema = `
-CREATE TABLE IF NOT EXISTS Message (
-	id INTEGER NOT NULL PRIMARY KEY,
-	author INTEGER NOT NULL,
-	channel INTEGER NOT NULL,
-	guild INTEGER,
-	content TEXT NOT NULL,
-	json TEXT NOT NULL
-);
-`
-
-var stmtInsert *sql.Stmt
-
-func newOutput(dir string) (*output, error) {
-	o := new(output)
-	err := os.MkdirAll(dir, 0777)
-	if err != nil {
-		return nil, err
+// deleteOwnPost deletes the forum post t that the user started, unless some
+// of their messages in it were left, as search tells regardless of the
+// filters. left reports whether the run already knows some were.
+func (d *deleter) deleteOwnPost(t target, left bool) {
+	if left {
+		log.Printf("Not deleting forum post %s, some of your messages in it weren't deleted\n", t)
+		return
 	}
-	o.DB, err = sql.Open("sqlite3", path.Join(dir, "messages.db"))
+	n, err := d.remaining(t.guildID, t.channelID)
 	if err != nil {
-		return nil, err
+		log.Printf("Not deleting forum post %s, couldn't check whether your messages in it are gone: %s\n", t, err)
+		return
 	}
-	_, err = o.Exec(schema)
-	if err != nil {
-		return nil, err
+	if n > 0 {
+		log.Printf("Not deleting forum post %s, %d of your messages are still in it\n", t, n)
+		return
 	}
-	stmtInsert, err = o.Prepare("INSERT INTO Message (id, author, channel, guild, content, json) VALUES(?, ?, ?, ?, ?, ?)")
-	if err != nil {
-		return nil, err
+	if err := d.c.DeleteChannel(t.channelID, ""); err != nil {
+		log.Printf("Error deleting forum post %s: %s\n", t, err)
+	} else {
+		log.Printf("Deleted forum post %s\n", t)
 	}
-	o.attdir = path.Join(dir, "attachments")
-	return o, nil
 }
 
-type output struct {
-	*sql.DB
-	attdir string
+// leaveGuilds leaves the guilds in gids where search finds none of the
+// user's messages left, once the user confirms the list of them, unless yes
+// is set.
+func (d *deleter) leaveGuilds(gids []discord.GuildID, names map[discord.GuildID]string, yes bool) error {
+	var empty []discord.GuildID
+	for _, gid := range gids {
+		n, err := d.remaining(gid, 0)
+		switch {
+		case err != nil:
+			log.Printf("Not leaving guild %s, searching it failed: %s\n", gid, err)
+		case n > 0:
+			log.Printf("Not leaving guild %s, %d of your messages are left in it\n", gid, n)
+		default:
+			empty = append(empty, gid)
+		}
+	}
+	if len(empty) == 0 {
+		return nil
+	}
+	if !yes {
+		fmt.Fprintln(os.Stderr, "None of your messages are left in these guilds, which you'll leave:")
+		for _, gid := range empty {
+			if name, ok := names[gid]; ok {
+				fmt.Fprintf(os.Stderr, "  %s (%s)\n", name, gid)
+			} else {
+				fmt.Fprintf(os.Stderr, "  %s\n", gid)
+			}
+		}
+		ok, err := confirm(os.Stdin, "Leave them?")
+		if err != nil {
+			return fmt.Errorf("reading confirmation: %w", err)
+		}
+		if !ok {
+			log.Println("Not confirmed, staying in them")
+			return nil
+		}
+	}
+	for _, gid := range empty {
+		if err := d.c.LeaveGuild(gid); err != nil {
+			log.Printf("Error leaving guild %s: %s\n", gid, err)
+		} else {
+			log.Printf("Left guild %s\n", gid)
+		}
+	}
+	return nil
 }
 
-func (o *output) logMessage(m discord.Message) error {
-	var guild string
-	if m.GuildID.IsNull() {
-		guild = "dm"
+// releaseHeld deletes the messages held by a two-phase run, once the user
+// confirms the summary of them, unless yes is set.
+func (d *deleter) releaseHeld(ctx context.Context, yes bool) error {
+	h := d.hold
+	d.hold = nil
+	log.Println("Every message has been archived.")
+	h.print()
+	if len(h.held) == 0 {
+		return nil
+	}
+	if !yes {
+		ok, err := confirm(os.Stdin, "Delete them?")
+		if err != nil {
+			return fmt.Errorf("reading confirmation: %w", err)
+		}
+		if !ok {
+			log.Println("Not confirmed, stopping without deleting anything")
+			return nil
+		}
+	}
+	for _, hm := range h.held {
+		if err := d.waitPause(ctx); err != nil {
+			return err
+		}
+		d.output = hm.output
+		if err := d.remove(ctx, hm.m); err != nil {
+			return err
+		}
+		d.processed++
+	}
+	return nil
+}
+
+// finish prints the summary of a run that stopped with err, and returns the
+// error the run ends with.
+func (d *deleter) finish(err error) error {
+	if d.estimate != nil {
+		d.estimate.print()
 	} else {
-		guild = m.GuildID.String()
+		d.stats.dryRun = d.dryRun
+		d.stats.print()
 	}
-	attd := path.Join(o.attdir, guild, m.ChannelID.String())
-	err := os.MkdirAll(attd, 0777)
-	if err != nil {
-		return err
+	d.events.emit(event{Type: "done", Total: d.stats.deleted})
+	if errors.Is(err, errLimit) {
+		err = nil
 	}
-	for n, att := range m.Attachments {
-		attf := path.Join(attd, fmt.Sprintf("%d,%d %s",
-			m.ID,
-			n,
-			att.Filename,
-		))
-		f, err := os.Create(attf)
+	if err == nil && d.stats.failed > 0 {
+		err = errPartial
+	}
+	return err
+}
+
+// A target is a guild or a channel to delete messages from. If the channel
+// is set, only that channel is searched; the guild is null for DMs.
+type target struct {
+	guildID   discord.GuildID
+	channelID discord.ChannelID
+	// forumPost is set if the channel is a post in a forum channel.
+	forumPost bool
+	// ownPost is set if the channel is a forum post the user started.
+	ownPost bool
+	// groupDM, if set, is the name of the group DM the channel is.
+	groupDM string
+	// after, if set, is the last message already processed, so that the
+	// search resumes after it.
+	after discord.MessageID
+	// policy, if set, replaces the run's policy for this target, and
+	// noArchive makes its messages not be archived.
+	policy    *policy
+	noArchive bool
+}
+
+func (t target) String() string {
+	if t.groupDM != "" {
+		return fmt.Sprintf("group DM %s (%s)", t.groupDM, chanURL(t.guildID, t.channelID))
+	}
+	if t.channelID.IsValid() {
+		return chanURL(t.guildID, t.channelID)
+	}
+	return "guild " + t.guildID.String()
+}
+
+// contains reports whether m was sent in t.
+func (t target) contains(m discord.Message) bool {
+	if t.channelID.IsValid() {
+		return m.ChannelID == t.channelID
+	}
+	return m.GuildID == t.guildID
+}
+
+// closeDM closes the DM t, which only hides it from the DM list. Group DMs
+// are left alone, since closing them leaves them.
+func closeDM(c *api.Client, t target) {
+	ch, err := c.Channel(t.channelID)
+	switch {
+	case err != nil:
+		log.Printf("Error closing %s: %s\n", t, err)
+	case ch.Type == discord.GroupDM:
+		log.Printf("Not closing %s, closing a group DM leaves it; use -leave-groups for that\n", t)
+	case ch.Type != discord.DirectMessage:
+	default:
+		if err := c.DeleteChannel(t.channelID, ""); err != nil {
+			log.Printf("Error closing %s: %s\n", t, err)
+		} else {
+			log.Printf("Closed %s\n", t)
+		}
+	}
+}
+
+// confirm asks the yes or no question and reads the answer from r. Only
+// yes counts as yes.
+func confirm(r io.Reader, question string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// filterGuilds removes the targets whose guilds aren't allowed by the only and
+// skip lists. DM targets are never removed.
+func filterGuilds(targets []target, only, skip snowflakes) []target {
+	var kept []target
+	for _, t := range targets {
+		if !guildAllowed(t.guildID, only, skip) {
+			log.Printf("Skipping %s\n", t)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
+
+// filterChannels removes the targets for the channels in skip. Guild
+// targets are kept, their messages are filtered by the policy instead.
+func filterChannels(targets []target, skip snowflakes) []target {
+	var kept []target
+	for _, t := range targets {
+		if skip.contains(discord.Snowflake(t.channelID)) {
+			log.Printf("Skipping %s\n", t)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
+
+// restrictChannels replaces every guild target with a target for each of
+// the channels in only that are in the guild, and removes the channel
+// targets for channels not in only.
+func restrictChannels(c *api.Client, targets []target, only snowflakes) ([]target, error) {
+	var restricted []target
+	for _, t := range targets {
+		if t.channelID.IsValid() {
+			if only.contains(discord.Snowflake(t.channelID)) {
+				restricted = append(restricted, t)
+			} else {
+				log.Printf("Skipping %s\n", t)
+			}
+			continue
+		}
+		for _, id := range only {
+			ch, err := c.Channel(discord.ChannelID(id))
+			if err != nil {
+				return nil, err
+			}
+			if ch.GuildID != t.guildID {
+				log.Printf("Skipping channel %s, it isn't in %s\n", ch.ID, t)
+				continue
+			}
+			restricted = append(restricted, target{guildID: t.guildID, channelID: ch.ID, policy: t.policy, noArchive: t.noArchive})
+		}
+	}
+	return restricted, nil
+}
+
+// restrictNSFW replaces every guild target with a target for each of its
+// age-restricted channels, and removes the other channel targets.
+func restrictNSFW(c *api.Client, targets []target) ([]target, error) {
+	var restricted []target
+	for _, t := range targets {
+		if !t.guildID.IsValid() {
+			log.Printf("Skipping %s\n", t)
+			continue
+		}
+		chs, err := nsfwChannels(c, t.guildID)
 		if err != nil {
-			return fmt.Errorf("creating attachment file: %w", err)
+			return nil, err
+		}
+		for _, ch := range chs {
+			if !t.channelID.IsValid() || ch.ID == t.channelID {
+				restricted = append(restricted, target{guildID: t.guildID, channelID: ch.ID, policy: t.policy, noArchive: t.noArchive})
+			}
 		}
-		resp, err := http.Get(att.URL)
+	}
+	return restricted, nil
+}
+
+// restrictThreads replaces every guild target with a target for each of its
+// threads, and every channel target with targets for the threads in it.
+// Thread targets are kept as they are.
+func restrictThreads(c *api.Client, targets []target) ([]target, error) {
+	var restricted []target
+	for _, t := range targets {
+		if !t.guildID.IsValid() {
+			log.Printf("Skipping %s\n", t)
+			continue
+		}
+		if t.channelID.IsValid() {
+			ch, err := c.Channel(t.channelID)
+			if err != nil {
+				return nil, err
+			}
+			if isThread(ch.Type) {
+				restricted = append(restricted, t)
+				continue
+			}
+		}
+		threads, err := guildThreads(c, t.guildID)
 		if err != nil {
-			f.Close()
-			return fmt.Errorf("requesting attachment contents: %w", err)
+			return nil, err
+		}
+		for _, th := range threads {
+			if !t.channelID.IsValid() || th.ParentID == t.channelID {
+				restricted = append(restricted, target{guildID: t.guildID, channelID: th.ID, policy: t.policy, noArchive: t.noArchive})
+			}
+		}
+	}
+	return restricted, nil
+}
+
+// guildAllowed reports whether the only and skip lists allow touching a
+// guild. DMs are always allowed.
+func guildAllowed(gid discord.GuildID, only, skip snowflakes) bool {
+	if !gid.IsValid() {
+		return true
+	}
+	id := discord.Snowflake(gid)
+	return !(len(only) > 0 && !only.contains(id) || skip.contains(id))
+}
+
+// splitGuilds replaces every guild target with a target for each of its
+// channels, sorted by the given order.
+func splitGuilds(c *api.Client, targets []target, order string) ([]target, error) {
+	var split []target
+	for _, t := range targets {
+		if t.channelID.IsValid() {
+			split = append(split, t)
+			continue
 		}
-		_, err = io.Copy(f, resp.Body)
-		f.Close()
-		resp.Body.Close()
+		chs, err := guildChannels(c, t.guildID)
 		if err != nil {
-			return fmt.Errorf("downloading attachment: %w", err)
+			return nil, err
+		}
+		sortChannels(chs, order)
+		for _, ch := range chs {
+			split = append(split, target{guildID: t.guildID, channelID: ch.ID, policy: t.policy, noArchive: t.noArchive})
+		}
+	}
+	return split, nil
+}
+
+// addForumPosts adds a target for each forum post of every guild target,
+// ahead of the guild, and marks the channel targets that are forum posts.
+func addForumPosts(c *api.Client, targets []target) ([]target, error) {
+	posts := make(map[discord.GuildID][]discord.Channel)
+	var all []target
+	for _, t := range targets {
+		if !t.guildID.IsValid() {
+			all = append(all, t)
+			continue
+		}
+		chs, ok := posts[t.guildID]
+		if !ok {
+			var err error
+			chs, err = forumPosts(c, t.guildID)
+			if err != nil {
+				return nil, err
+			}
+			posts[t.guildID] = chs
+		}
+		if t.channelID.IsValid() {
+			for _, ch := range chs {
+				if ch.ID == t.channelID {
+					t.forumPost = true
+				}
+			}
+			all = append(all, t)
+			continue
+		}
+		for _, ch := range chs {
+			all = append(all, target{guildID: t.guildID, channelID: ch.ID, forumPost: true, policy: t.policy, noArchive: t.noArchive})
+		}
+		all = append(all, t)
+	}
+	return all, nil
+}
+
+// connect gives the caches of p, which may be a target's policy, what they
+// need to fetch from Discord.
+func (d *deleter) connect(p *policy) {
+	if p.kinds != nil {
+		p.kinds.fetch = d.c.Channel
+	}
+	if p.pins != nil {
+		p.pins.fetch = d.c.PinnedMessages
+	}
+	if d.unpin != nil {
+		d.unpin.fetch = d.c.PinnedMessages
+	}
+	if p.replyFinder != nil {
+		p.replyFinder.fetch = d.c.MessagesAfter
+		p.replyFinder.self = d.self
+	}
+	if p.latest != nil {
+		p.latest.fetch = d.latestMessages
+	}
+	if p.sample != nil {
+		p.sample.self = d.self
+	}
+}
+
+// deleter holds the state shared between the targets of a run.
+type deleter struct {
+	c      *session.Session
+	self   discord.UserID
+	output *output
+	policy *policy
+	// paginate moves searches from one page to the next.
+	paginate pagination
+	// has narrows searches to messages with all of these kinds of
+	// content.
+	has []string
+	// dumps, if set, keeps the raw search pages.
+	dumps  *searchDumps
+	limits *chanLimits
+	pacer  *pacer
+	// scrubText, if set, is what messages are edited to before being
+	// deleted, at the pace of editLimits and editPacer.
+	scrubText  string
+	editLimits *chanLimits
+	editPacer  *pacer
+	// channelTimeout, if set, is how long a target is worked on before
+	// moving on to the next one and coming back to it at the end.
+	channelTimeout time.Duration
+	// verifyArchive makes messages only be deleted once they're confirmed
+	// to be in the archive.
+	verifyArchive bool
+	// maxETA, if set, is the longest a target may be estimated to take
+	// when starting on it.
+	maxETA time.Duration
+	// limit, if set, is the number of messages deleted after which the
+	// run stops with errLimit.
+	limit uint
+	// dryRun makes messages be logged instead of deleted, everything else
+	// going as usual.
+	dryRun bool
+	// estimate, if set, tallies the messages that would be deleted,
+	// instead of archiving and deleting them.
+	estimate *estimate
+	// hold, if set, keeps the messages to delete for later, once they've
+	// been archived.
+	hold *holding
+	// unpin, if set, makes pinned messages be unpinned before being
+	// deleted, except in the channels of noUnpin, where the user can't.
+	unpin   *pinCache
+	noUnpin map[discord.ChannelID]bool
+	// archiveOnly makes messages be archived but never deleted.
+	archiveOnly bool
+	pause       chan struct{}
+	// gatewayDead receives an error once the gateway, which the pause
+	// depends on, gives up reconnecting. If keepWithoutGateway is set, the
+	// run continues without the pause.
+	gatewayDead        <-chan error
+	keepWithoutGateway bool
+	events             *eventLog
+
+	// unarchiveText is the content of the message sent to unarchive a
+	// thread. If noUnarchive is set, messages in archived threads are
+	// skipped instead.
+	unarchiveText string
+	noUnarchive   bool
+	// archived holds the errors of the archived threads skipped because
+	// of noUnarchive.
+	archived map[discord.ChannelID]error
+	// verbose and noContentLog control how much of a message's content
+	// is logged alongside its URL.
+	verbose      bool
+	noContentLog bool
+
+	start     time.Time
+	processed uint
+	stats     stats
+}
+
+// errLimit is returned by handle once -limit messages have been deleted.
+var errLimit = errors.New("deletion limit reached")
+
+// errChannelTimeout is returned by purge when a target took longer than the
+// channel timeout.
+var errChannelTimeout = errors.New("channel timed out")
+
+// purge deletes the user's messages in t. It returns an error if the run
+// can't go on, or errChannelTimeout with t updated to resume from where it
+// stopped.
+func (d *deleter) purge(ctx context.Context, t *target) error {
+	first := true
+	page := func(total uint) error {
+		log.Printf("%d messages remaining.\n", total)
+		if d.processed > 0 {
+			log.Printf("Estimated remaining time: %s\n", d.eta(total))
 		}
+		if !first {
+			return nil
+		}
+		first = false
+		if eta := d.eta(total); d.maxETA > 0 && eta > d.maxETA {
+			return fmt.Errorf("deleting %d messages in %s would take about %s, more than -max-eta; use -force to go ahead anyway", total, t, eta.Round(time.Second))
+		}
+		return nil
 	}
-	content := m.Content
-	m.Content = ""
-	j, err := json.Marshal(m)
-	if _, err := stmtInsert.Exec(m.ID, m.Author.ID, m.ChannelID, m.GuildID, content, j); err != nil {
-		if e, ok := err.(sqlite3.Error); !ok || e.Code != sqlite3.ErrConstraint {
+	if t.forumPost {
+		deleted := d.stats.deleted
+		defer func() {
+			d.stats.forumPosts++
+			d.stats.forumDeleted += d.stats.deleted - deleted
+		}()
+	}
+	tctx := ctx
+	if d.channelTimeout > 0 {
+		var cancel context.CancelFunc
+		tctx, cancel = context.WithTimeout(ctx, d.channelTimeout)
+		defer cancel()
+	}
+	err := d.search(tctx, *t, page, func(m discord.Message) error {
+		if err := d.waitPause(tctx); err != nil {
+			return err
+		}
+		if err := d.handle(tctx, m); err != nil {
 			return err
 		}
+		d.processed++
+		t.after = m.ID
+		return nil
+	})
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return errChannelTimeout
 	}
-	return nil
+	return err
 }
 
-func deleteMsg(c *api.Client, m discord.Message) error {
-	err := c.DeleteMessage(m.ChannelID, m.ID, "")
-	if err == nil {
+// assumedDeleteTime is how long a deletion is assumed to take before any
+// have been made. It errs on the slow side.
+const assumedDeleteTime = 1500 * time.Millisecond
+
+// eta estimates how long deleting n more messages takes.
+func (d *deleter) eta(n uint) time.Duration {
+	per := assumedDeleteTime
+	if d.processed > 0 {
+		per = time.Since(d.start) / time.Duration(d.processed)
+	}
+	return per * time.Duration(n)
+}
+
+// waitPause pauses for 30 seconds after the user last sent a message, so the
+// tool doesn't delete anything while they're active.
+func (d *deleter) waitPause(ctx context.Context) error {
+	select {
+	case <-d.pause:
+		d.events.emit(event{Type: "paused"})
+		timer := time.NewTimer(30 * time.Second)
+		for {
+			select {
+			case <-timer.C:
+				d.events.emit(event{Type: "resumed"})
+				return nil
+			case <-d.pause:
+				timer.Reset(30 * time.Second)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	case err := <-d.gatewayDead:
+		if !d.keepWithoutGateway {
+			return fmt.Errorf("gateway connection lost: %w", err)
+		}
+		log.Println("Gateway connection lost, continuing without pausing:", err)
+		d.gatewayDead = nil
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
 		return nil
 	}
-	var derr *httputil.HTTPError
-	if ok := errors.As(err, &derr); ok {
-		switch derr.Code {
-		case UnknownMessage:
+}
+
+// handle archives and deletes a single message. It returns an error if the
+// run can't go on.
+func (d *deleter) handle(ctx context.Context, m discord.Message) error {
+	del, include := d.policy.shouldDelete(m)
+	if !include {
+		return nil
+	}
+	if d.estimate != nil {
+		if del && m.Author.ID == d.self {
+			d.estimate.add(m)
+		}
+		return nil
+	}
+	if d.output != nil {
+		err := d.output.logMessage(m)
+		if err != nil {
+			return fmt.Errorf("logging message %s: %w", m.URL(), err)
+		}
+		if d.archiveOnly {
+			d.stats.archived++
+			return nil
+		}
+	}
+	if m.Author.ID != d.self {
+		return nil
+	}
+	if !del {
+		log.Printf("Skipping %s, it's kept by filters\n", d.describe(m))
+		d.stats.kept++
+		return nil
+	}
+	if d.hold != nil {
+		d.hold.add(m, d.output)
+		return nil
+	}
+	return d.remove(ctx, m)
+}
+
+// remove deletes a message handle decided to delete, once it's confirmed to
+// be archived if need be. It returns an error if the run can't go on.
+func (d *deleter) remove(ctx context.Context, m discord.Message) error {
+	if d.output != nil && d.verifyArchive {
+		err := d.output.verify(m)
+		var merr *missingAttachmentError
+		switch {
+		case errors.As(err, &merr):
+			d.stats.skipped++
+			log.Printf("Holding %s back, its %s; -fetch-attachments can download it later\n", d.describe(m), err)
 			return nil
-		case SystemMessageActionUnavailable:
+		case err != nil:
+			d.stats.skipped++
+			log.Printf("Not deleting %s, archiving it failed: %s\n", d.describe(m), err)
 			return nil
-		case InvalidActionOnArchivedThread:
-			msg, err := c.SendMessage(m.ChannelID, "\u200B")
-			if err != nil {
-				return fmt.Errorf("sending message to unarchive thread %s: %w", chanURL(m.GuildID, m.ChannelID), err)
+		}
+	}
+	var err error
+	if d.dryRun {
+		log.Printf("Would delete %s\n", d.describe(m))
+	} else {
+		if d.unpin != nil {
+			d.unpinFirst(m)
+		}
+		if d.scrubText != "" {
+			if err := d.scrub(ctx, m); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("Warning: couldn't edit %s before deleting it: %s\n", d.describe(m), err)
 			}
-			err = c.DeleteMessage(m.ChannelID, m.ID, "")
-			if err != nil {
-				return fmt.Errorf("deleting unarchive-trigger message %s: %w", msg.URL(), err)
+		}
+		err = d.delete(ctx, m)
+	}
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var uerr *unarchiveError
+	switch {
+	case errors.As(err, &uerr):
+		d.stats.skipped++
+		d.stats.addError(err)
+		d.stats.addSkippedThread(uerr.guildID, uerr.channelID)
+		log.Printf("Skipping %s: %s\n", d.describe(m), err)
+	case err != nil:
+		d.stats.failed++
+		d.stats.addError(err)
+		d.events.emit(event{Type: "error", GuildID: m.GuildID, ChannelID: m.ChannelID, MessageID: m.ID, Error: err.Error()})
+		log.Printf("Error deleting %s: %s\n", d.describe(m), err)
+	default:
+		d.stats.addDeleted(m)
+		if d.policy.kinds != nil {
+			if kind, err := d.policy.kinds.kind(m.ChannelID); err == nil {
+				d.stats.addKind(kind)
 			}
-			return deleteMsg(c, m)
+		}
+		if !d.dryRun {
+			d.events.emit(event{Type: "message_deleted", GuildID: m.GuildID, ChannelID: m.ChannelID, MessageID: m.ID})
+		}
+		if d.limit > 0 && d.stats.deleted >= d.limit {
+			log.Printf("Reached -limit of %d deletions, stopping after %s (ID %s)\n", d.limit, m.URL(), m.ID)
+			return errLimit
 		}
 	}
-	return err
+	return nil
+}
+
+// previewLen is the number of characters of content shown in log lines.
+const previewLen = 40
+
+// describe returns the URL of m followed by its content, which is truncated
+// unless verbose logging is enabled.
+func (d *deleter) describe(m discord.Message) string {
+	if d.noContentLog || m.Content == "" {
+		return m.URL()
+	}
+	content := strings.Join(strings.Fields(m.Content), " ")
+	if r := []rune(content); !d.verbose && len(r) > previewLen {
+		content = string(r[:previewLen]) + "…"
+	}
+	return fmt.Sprintf("%s %q", m.URL(), content)
+}
+
+// maxRetries is how many times a deletion that failed with a network error is
+// retried before giving up. Rate limited deletions are retried indefinitely.
+const maxRetries = 3
+
+// delete deletes m, retrying on rate limits and network errors. Retrying is
+// safe even if an earlier attempt went through, since deleteMsg treats an
+// already deleted message as success.
+func (d *deleter) delete(ctx context.Context, m discord.Message) error {
+	var err error
+	for tries := 0; ; {
+		if err := d.limits.wait(ctx, m.ChannelID); err != nil {
+			return err
+		}
+		if err := d.pacer.wait(ctx); err != nil {
+			return err
+		}
+		err = d.deleteMsg(m)
+		switch {
+		case err == nil:
+			d.pacer.succeeded()
+		case isRateLimited(err):
+			continue
+		case isNetworkError(err) && tries < maxRetries:
+			tries++
+			select {
+			case <-time.After(time.Duration(tries) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		return err
+	}
+}
+
+// unpinFirst unpins m if it's pinned. Channels where the user isn't allowed
+// to are remembered, and their messages deleted without unpinning them.
+func (d *deleter) unpinFirst(m discord.Message) {
+	if d.noUnpin[m.ChannelID] {
+		return
+	}
+	pinned := m.Pinned
+	if !pinned {
+		var err error
+		pinned, err = d.unpin.pinned(m)
+		if err != nil {
+			log.Printf("Warning: couldn't fetch the pins of %s, not unpinning %s: %s\n", chanURL(m.GuildID, m.ChannelID), m.URL(), err)
+			return
+		}
+	}
+	if !pinned {
+		return
+	}
+	err := d.c.UnpinMessage(m.ChannelID, m.ID, "")
+	var herr *httputil.HTTPError
+	switch {
+	case err == nil:
+		d.stats.unpinned++
+	case errors.As(err, &herr) && herr.Code == MissingPermissions:
+		if d.noUnpin == nil {
+			d.noUnpin = make(map[discord.ChannelID]bool)
+		}
+		d.noUnpin[m.ChannelID] = true
+		log.Printf("Warning: you can't unpin messages in %s, which needs the Manage Messages permission; deleting its pinned messages without unpinning them\n", chanURL(m.GuildID, m.ChannelID))
+	default:
+		log.Printf("Warning: couldn't unpin %s: %s\n", m.URL(), err)
+	}
+}
+
+// scrub edits m to the scrub text, without its attachments and embeds,
+// retrying on rate limits and network errors. Messages that can't be edited,
+// such as system messages, are left alone.
+func (d *deleter) scrub(ctx context.Context, m discord.Message) error {
+	if m.Type != discord.DefaultMessage && m.Type != discord.InlinedReplyMessage {
+		return nil
+	}
+	if m.Content == d.scrubText && len(m.Attachments) == 0 && len(m.Embeds) == 0 {
+		return nil
+	}
+	data := api.EditMessageData{
+		Content:     option.NewNullableString(d.scrubText),
+		Embeds:      &[]discord.Embed{},
+		Attachments: &[]discord.Attachment{},
+	}
+	for tries := 0; ; {
+		if err := d.editLimits.wait(ctx, m.ChannelID); err != nil {
+			return err
+		}
+		if err := d.editPacer.wait(ctx); err != nil {
+			return err
+		}
+		_, err := d.c.EditMessageComplex(m.ChannelID, m.ID, data)
+		var herr *httputil.HTTPError
+		switch {
+		case err == nil:
+			d.editPacer.succeeded()
+			d.stats.scrubbed++
+		case errors.As(err, &herr) && herr.Code == UnknownMessage:
+			err = nil
+		case isRateLimited(err):
+			continue
+		case isNetworkError(err) && tries < maxRetries:
+			tries++
+			select {
+			case <-time.After(time.Duration(tries) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		return err
+	}
+}
+
+// mentionRe matches user, role and everyone/here mentions.
+var mentionRe = regexp.MustCompile(`<@[!&]?\d+>|@everyone|@here`)
+
+func (d *deleter) deleteMsg(m discord.Message) error {
+	// Once a thread is known to be archived, don't try deleting its other
+	// messages either.
+	if err, ok := d.archived[m.ChannelID]; ok {
+		return err
+	}
+	c := d.c.Client
+	for unarchived := false; ; unarchived = true {
+		err := c.DeleteMessage(m.ChannelID, m.ID, "")
+		if err == nil {
+			return nil
+		}
+		var derr *httputil.HTTPError
+		if ok := errors.As(err, &derr); ok {
+			switch derr.Code {
+			case UnknownMessage:
+				return nil
+			case SystemMessageActionUnavailable:
+				return nil
+			case InvalidActionOnArchivedThread:
+				if unarchived {
+					return &unarchiveError{m.GuildID, m.ChannelID, err}
+				}
+				if d.noUnarchive {
+					uerr := &unarchiveError{m.GuildID, m.ChannelID, fmt.Errorf("-no-unarchive is set: %w", err)}
+					if d.archived == nil {
+						d.archived = make(map[discord.ChannelID]error)
+					}
+					d.archived[m.ChannelID] = uerr
+					return uerr
+				}
+				if err := d.unarchive(m.GuildID, m.ChannelID); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		return err
+	}
+}
+
+// unarchive unarchives a thread by sending a message to it, then deletes
+// that message.
+func (d *deleter) unarchive(gid discord.GuildID, cid discord.ChannelID) error {
+	c := d.c.Client
+	msg, err := c.SendMessage(cid, d.unarchiveText)
+	if err != nil {
+		return &unarchiveError{gid, cid, err}
+	}
+	d.stats.unarchived++
+	msg.GuildID = gid
+	if err := c.DeleteMessage(cid, msg.ID, ""); err != nil {
+		return fmt.Errorf("deleting unarchive-trigger message %s: %w", msg.URL(), err)
+	}
+	return nil
+}
+
+// unarchiveError is returned when a message couldn't be deleted because its
+// thread is archived and couldn't be unarchived, e.g. because it's locked.
+type unarchiveError struct {
+	guildID   discord.GuildID
+	channelID discord.ChannelID
+	err       error
+}
+
+func (e *unarchiveError) Error() string {
+	return fmt.Sprintf("couldn't unarchive thread %s: %s", chanURL(e.guildID, e.channelID), e.err)
+}
+
+func (e *unarchiveError) Unwrap() error {
+	return e.err
+}
+
+// checkArchive prints what would happen to every archived message under the
+// policy, without deleting anything.
+func (d *deleter) checkArchive(o *output) error {
+	return o.messages(func(m discord.Message) error {
+		switch del, include := d.policy.shouldDelete(m); {
+		case !include:
+		case del:
+			fmt.Println("delete", d.describe(m))
+		default:
+			fmt.Println("keep", d.describe(m))
+		}
+		return nil
+	})
+}
+
+// diffArchive reports the messages in targets that search finds but aren't
+// archived, and the archived messages in targets that search doesn't find.
+func (d *deleter) diffArchive(ctx context.Context, o *output, targets []target) error {
+	archived := make(map[discord.MessageID]discord.Message)
+	err := o.messages(func(m discord.Message) error {
+		for _, t := range targets {
+			if t.contains(m) {
+				archived[m.ID] = m
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var missing []discord.Message
+	for _, t := range targets {
+		err := d.search(ctx, t, nil, func(m discord.Message) error {
+			if _, ok := archived[m.ID]; ok {
+				delete(archived, m.ID)
+			} else {
+				missing = append(missing, m)
+			}
+			return ctx.Err()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d messages on Discord are missing from the archive:\n", len(missing))
+	for _, m := range missing {
+		fmt.Println(m.URL())
+	}
+	gone := make([]discord.Message, 0, len(archived))
+	for _, m := range archived {
+		gone = append(gone, m)
+	}
+	sort.Slice(gone, func(i, j int) bool { return gone[i].ID < gone[j].ID })
+	fmt.Printf("%d archived messages are no longer on Discord:\n", len(gone))
+	for _, m := range gone {
+		fmt.Println(m.URL())
+	}
+	return nil
+}
+
+func isRateLimited(err error) bool {
+	var derr *httputil.HTTPError
+	return errors.As(err, &derr) && derr.Status == http.StatusTooManyRequests
+}
+
+func isNetworkError(err error) bool {
+	var rerr httputil.RequestError
+	return errors.As(err, &rerr)
 }
 
 func chanURL(gid discord.GuildID, cid discord.ChannelID) string {
 	var g string
-	if gid.IsNull() {
+	if !gid.IsValid() {
 		g = "@me"
 	} else {
 		g = gid.String()
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// TestMain runs discorddel itself instead of the tests when the tests run it
+// through fakeDiscord.run.
+func TestMain(m *testing.M) {
+	if os.Getenv("DISCORDDEL_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testEpoch is when the first test message was sent.
+var testEpoch = time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+
+// testID returns the ID of a message sent n minutes after testEpoch.
+func testID(n int) discord.MessageID {
+	return discord.MessageID(discord.NewSnowflake(testEpoch.Add(time.Duration(n) * time.Minute)))
+}
+
+// flagID formats an ID as a flag value.
+func flagID(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
+
+func openArchive(t *testing.T, dir string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "messages.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPurgePaginates(t *testing.T) {
+	const gid, chid = 5, 10
+	var msgs []discord.Message
+	var others []discord.MessageID
+	for i := 0; i < 60; i++ {
+		author := testSelf
+		if i%10 == 0 {
+			author = 2
+			others = append(others, testID(i))
+		}
+		msgs = append(msgs, testMessage(testID(i), gid, chid, author, "hello"))
+	}
+	f := newFakeDiscord(msgs...)
+	f.run(t, "-channel", flagID(chid), "-archive", t.TempDir())
+	if left := f.left(); !equalIDs(left, others) {
+		t.Errorf("left %v, want %v", left, others)
+	}
+	for id, n := range f.deletes {
+		if n != 1 {
+			t.Errorf("%s deleted %d times", id, n)
+		}
+	}
+	// Three pages of 25 of the 54 messages, and one finding none left.
+	if f.searches != 4 {
+		t.Errorf("searched %d times, want 4", f.searches)
+	}
+}
+
+func TestPurgeArchives(t *testing.T) {
+	const gid, chid = 5, 10
+	f := newFakeDiscord(
+		testMessage(testID(0), gid, chid, testSelf, "first"),
+		testMessage(testID(1), gid, chid, 2, "someone else's"),
+		testMessage(testID(2), gid, chid, testSelf, "second"),
+	)
+	dir := t.TempDir()
+	f.run(t, "-guild", flagID(gid), "-channel", flagID(chid), "-archive", dir)
+	rows, err := openArchive(t, dir).Query("SELECT id, author, channel, guild, content FROM Message ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []discord.Message
+	for rows.Next() {
+		var m discord.Message
+		if err := rows.Scan(&m.ID, &m.Author.ID, &m.ChannelID, &m.GuildID, &m.Content); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m)
+	}
+	if len(got) != 2 {
+		t.Fatalf("archived %d messages, want 2", len(got))
+	}
+	for i, want := range []discord.Message{
+		testMessage(testID(0), gid, chid, testSelf, "first"),
+		testMessage(testID(2), gid, chid, testSelf, "second"),
+	} {
+		m := got[i]
+		if m.ID != want.ID || m.Author.ID != want.Author.ID || m.ChannelID != want.ChannelID || m.GuildID != want.GuildID || m.Content != want.Content {
+			t.Errorf("archived %+v, want %+v", m, want)
+		}
+	}
+	want := []discord.MessageID{testID(1)}
+	if left := f.left(); !equalIDs(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
+
+func TestPurgeUnarchivesThreads(t *testing.T) {
+	const gid, thread = 5, 20
+	f := newFakeDiscord(
+		testMessage(testID(0), gid, thread, testSelf, "in the thread"),
+		testMessage(testID(1), gid, thread, testSelf, "also in the thread"),
+	)
+	f.archived[thread] = true
+	f.run(t, "-channel", flagID(thread), "-archive", t.TempDir())
+	if f.sent != 1 {
+		t.Errorf("sent %d messages to unarchive the thread, want 1", f.sent)
+	}
+	// The message sent to unarchive the thread is deleted too.
+	if left := f.left(); len(left) != 0 {
+		t.Errorf("left %v", left)
+	}
+}
+
+func TestPurgeLockedThread(t *testing.T) {
+	const gid, thread = 5, 20
+	f := newFakeDiscord(
+		testMessage(testID(0), gid, thread, testSelf, "in the thread"),
+		testMessage(testID(1), gid, thread, testSelf, "also in the thread"),
+	)
+	f.archived[thread] = true
+	f.locked[thread] = true
+	out := f.run(t, "-channel", flagID(thread), "-archive", t.TempDir())
+	checkSummary(t, out, "Deleted 0 messages, skipped 2 (0 kept by filters), failed to delete 0.")
+	// Nothing is left behind in the thread besides the messages.
+	want := []discord.MessageID{testID(0), testID(1)}
+	if left := f.left(); !equalIDs(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+	if f.sent != 0 {
+		t.Errorf("sent %d messages to the locked thread", f.sent)
+	}
+}
+
+func TestPurgeFilters(t *testing.T) {
+	const gid, chid = 5, 10
+	f := newFakeDiscord(
+		testMessage(testID(0), gid, chid, testSelf, "delete me"),
+		testMessage(testID(1), gid, chid, testSelf, "delete me, but keep me"),
+		testMessage(testID(2), gid, chid, testSelf, "leave me alone"),
+		testMessage(testID(3), gid, chid, testSelf, "delete me too"),
+		testMessage(testID(60*24), gid, chid, testSelf, "delete me, a day later"),
+	)
+	dir := t.TempDir()
+	out := f.run(t, "-channel", flagID(chid), "-archive", dir,
+		"-match", "^delete",
+		"-keep-match", "keep",
+		"-before", testEpoch.Add(time.Hour).Format(time.RFC3339),
+	)
+	want := []discord.MessageID{testID(1), testID(2), testID(60 * 24)}
+	if left := f.left(); !equalIDs(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+	checkSummary(t, out, "Deleted 2 messages, skipped 1 (1 kept by filters),")
+	// Kept messages are archived all the same.
+	var n int
+	if err := openArchive(t, dir).QueryRow("SELECT count(*) FROM Message WHERE id = ?", testID(1)).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("%s isn't archived", testID(1))
+	}
+}
+
+func TestPurgeOnlyUnengaged(t *testing.T) {
+	const gid, chid = 5, 10
+	replyTo := func(m discord.Message, to discord.MessageID) discord.Message {
+		m.Reference = &discord.MessageReference{MessageID: to}
+		return m
+	}
+	f := newFakeDiscord(
+		testMessage(testID(0), gid, chid, testSelf, "replied to"),
+		replyTo(testMessage(testID(1), gid, chid, 2, "a reply"), testID(0)),
+		testMessage(testID(2), gid, chid, testSelf, "only replied to by myself"),
+		replyTo(testMessage(testID(3), gid, chid, testSelf, "my own reply"), testID(2)),
+	)
+	f.run(t, "-channel", flagID(chid), "-archive", t.TempDir(), "-only-unengaged")
+	// The replies of others are found though search doesn't return them.
+	want := []discord.MessageID{testID(0), testID(1)}
+	if left := f.left(); !equalIDs(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
+
+func TestUnarchivedCount(t *testing.T) {
+	const gid, channel, archived, locked = 5, 10, 20, 30
+	for _, noUnarchive := range []bool{false, true} {
+		f := newFakeDiscord(
+			testMessage(testID(0), gid, channel, testSelf, "in the channel"),
+			testMessage(testID(1), gid, archived, testSelf, "in the archived thread"),
+			testMessage(testID(2), gid, archived, testSelf, "also in the archived thread"),
+			testMessage(testID(3), gid, locked, testSelf, "in the locked thread"),
+		)
+		f.archived[archived] = true
+		f.archived[locked] = true
+		f.locked[locked] = true
+		args := []string{"-guild", flagID(gid), "-archive", t.TempDir()}
+		if noUnarchive {
+			args = append(args, "-no-unarchive")
+		}
+		out := f.run(t, args...)
+		if noUnarchive {
+			checkSummary(t, out, "Deleted 1 messages, skipped 3 (0 kept by filters),")
+		} else {
+			checkSummary(t, out, "Deleted 3 messages, skipped 1 (0 kept by filters),")
+		}
+		// Only the archived thread that could be unarchived counts, once.
+		const unarchived = "Unarchived 1 threads"
+		if got := strings.Contains(out, unarchived); got == noUnarchive {
+			t.Errorf("with -no-unarchive %t, output has %q: %t\n%s", noUnarchive, unarchived, got, out)
+		}
+	}
+}
+
+func TestPurgeRetriedDelete(t *testing.T) {
+	const gid, chid = 5, 10
+	f := newFakeDiscord(testMessage(testID(0), gid, chid, testSelf, "hello"))
+	f.deleteStatus[testID(0)] = http.StatusTooManyRequests
+	out := f.run(t, "-channel", flagID(chid), "-archive", t.TempDir())
+	if f.deletes[testID(0)] != 2 {
+		t.Errorf("deleted %d times, want 2", f.deletes[testID(0)])
+	}
+	// The retry finds the message already gone, which counts as deleting it.
+	checkSummary(t, out, "Deleted 1 messages, skipped 0 (0 kept by filters), failed to delete 0.")
+}
+
+// checkSummary checks that the output of a run has the summary want.
+func checkSummary(t *testing.T, out, want string) {
+	t.Helper()
+	if !strings.Contains(out, want) {
+		t.Errorf("summary %q missing from output:\n%s", want, out)
+	}
+}
+
+func equalIDs(a, b []discord.MessageID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// estimate tallies the messages a run would delete, for -estimate.
+type estimate struct {
+	// pace is how long each deletion is assumed to take.
+	pace        time.Duration
+	messages    uint
+	attachments uint
+	bytes       uint64
+	first, last discord.MessageID
+	channels    map[discord.ChannelID]uint
+	guilds      map[discord.ChannelID]discord.GuildID
+}
+
+func (e *estimate) add(m discord.Message) {
+	e.messages++
+	for _, att := range m.Attachments {
+		e.attachments++
+		e.bytes += att.Size
+	}
+	if !e.first.IsValid() || m.ID < e.first {
+		e.first = m.ID
+	}
+	if m.ID > e.last {
+		e.last = m.ID
+	}
+	if e.channels == nil {
+		e.channels = make(map[discord.ChannelID]uint)
+		e.guilds = make(map[discord.ChannelID]discord.GuildID)
+	}
+	e.channels[m.ChannelID]++
+	e.guilds[m.ChannelID] = m.GuildID
+}
+
+func (e *estimate) print() {
+	log.Printf("%d messages would be deleted, with %d attachments totalling %s.\n", e.messages, e.attachments, formatBytes(e.bytes))
+	if e.messages == 0 {
+		return
+	}
+	log.Printf("They were sent from %s to %s.\n", e.first.Time().Format("2006-01-02"), e.last.Time().Format("2006-01-02"))
+	log.Printf("Deleting them would take about %s.\n", (e.pace * time.Duration(e.messages)).Round(time.Second))
+	ids := make([]discord.ChannelID, 0, len(e.channels))
+	for id := range e.channels {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return e.channels[ids[i]] > e.channels[ids[j]] })
+	for _, id := range ids {
+		log.Printf("  %s: %d\n", chanURL(e.guilds[id], id), e.channels[id])
+	}
+}
+
+// formatBytes formats n bytes in the largest binary unit it has at least
+// one of.
+func formatBytes(n uint64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(1024), 0
+	for m := n / 1024; m >= 1024 && exp < len(units)-1; m /= 1024 {
+		div *= 1024
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), units[exp])
+}
+
+// holding keeps the messages a two-phase run is to delete until the user
+// confirms the summary of them.
+type holding struct {
+	estimate
+	held []heldMessage
+}
+
+// heldMessage is a held message, with the archive it was logged in, if any.
+type heldMessage struct {
+	m      discord.Message
+	output *output
+}
+
+func (h *holding) add(m discord.Message, o *output) {
+	h.estimate.add(m)
+	h.held = append(h.held, heldMessage{m, o})
+}
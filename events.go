@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// event is a progress event, written as a line of JSON for other programs to
+// consume.
+type event struct {
+	Time      time.Time         `json:"time"`
+	Type      string            `json:"type"`
+	GuildID   discord.GuildID   `json:"guild_id,omitempty"`
+	ChannelID discord.ChannelID `json:"channel_id,omitempty"`
+	MessageID discord.MessageID `json:"message_id,omitempty"`
+	Total     uint              `json:"total"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// eventLog writes events as newline-delimited JSON. A nil *eventLog discards
+// everything.
+type eventLog struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+// newEventLog opens the event log at name, with "-" meaning stderr. The file
+// is created with mode if it doesn't exist.
+func newEventLog(name string, mode os.FileMode) (*eventLog, error) {
+	var w io.WriteCloser = os.Stderr
+	if name != "-" {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, mode)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &eventLog{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+func (l *eventLog) emit(ev event) {
+	if l == nil {
+		return
+	}
+	ev.Time = time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(ev)
+}
+
+func (l *eventLog) Close() error {
+	if l == nil || l.w == os.Stderr {
+		return nil
+	}
+	return l.w.Close()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+)
+
+// Exit codes, so that scripts can tell why the tool stopped.
+const (
+	exitOK           = 0 // everything was deleted
+	exitFatal        = 1 // an unexpected error occurred
+	exitConfig       = 2 // the flags are invalid
+	exitBadToken     = 3 // the token was rejected
+	exitInaccessible = 4 // a target couldn't be accessed
+	exitInterrupted  = 5 // the run was interrupted with work remaining
+	exitPartial      = 6 // the run completed, but some deletions failed
+)
+
+const exitCodesUsage = `
+Exit codes:
+  0  everything was deleted
+  1  an unexpected error occurred
+  2  the flags are invalid
+  3  the token was rejected
+  4  a target couldn't be accessed
+  5  the run was interrupted with work remaining
+  6  the run completed, but some deletions failed
+`
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", flag.CommandLine.Name())
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), exitCodesUsage)
+	}
+}
+
+// configError is returned for invalid flags.
+type configError struct {
+	msg string
+}
+
+func configErrorf(format string, v ...interface{}) error {
+	return configError{fmt.Sprintf(format, v...)}
+}
+
+func (e configError) Error() string {
+	return e.msg
+}
+
+// errPartial is returned when a run completed, but some messages couldn't
+// be deleted.
+var errPartial = errors.New("some messages couldn't be deleted")
+
+// exitCode returns the exit code for an error returned by run.
+func exitCode(err error) int {
+	var (
+		cerr configError
+		herr *httputil.HTTPError
+	)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &cerr):
+		return exitConfig
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, errPartial):
+		return exitPartial
+	case errors.As(err, &herr) && herr.Status == http.StatusUnauthorized:
+		return exitBadToken
+	case errors.As(err, &herr) && (herr.Status == http.StatusForbidden || herr.Status == http.StatusNotFound):
+		return exitInaccessible
+	}
+	return exitFatal
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/gorilla/websocket"
+)
+
+// testSelf is the user the tests run as.
+const testSelf discord.UserID = 1
+
+// fakeDiscord mimics the parts of the Discord API that purging uses: the
+// gateway, search, deleting messages, and sending messages to unarchive
+// threads.
+type fakeDiscord struct {
+	mu sync.Mutex
+	// messages are the messages in every channel, by ID.
+	messages map[discord.MessageID]discord.Message
+	// channels are the channels the messages were sent in.
+	channels map[discord.ChannelID]discord.Channel
+	// archived are the archived threads, which are unarchived by sending
+	// a message to them, unless they're locked.
+	archived map[discord.ChannelID]bool
+	locked   map[discord.ChannelID]bool
+	// pageSize is the number of results per search page.
+	pageSize int
+	// search, if set, answers searches instead of searchPage.
+	search func(q searchParams) searchPage
+	// deleteStatus makes the first deletion of a message be answered with
+	// an error status, even though it goes through, as if the response
+	// had been lost.
+	deleteStatus map[discord.MessageID]int
+
+	// files are the attachments served under /attachments/, by name.
+	files map[string][]byte
+	// cutOff makes the first download of an attachment break off halfway.
+	cutOff map[string]bool
+
+	srv      *httptest.Server
+	searches int
+	deletes  map[discord.MessageID]int
+	sent     int
+	nextID   discord.MessageID
+}
+
+// searchParams are the parameters of a search request.
+type searchParams struct {
+	guildID   discord.GuildID
+	channelID discord.ChannelID
+	authorID  discord.UserID
+	minID     discord.MessageID
+	maxID     discord.MessageID
+	cursor    string
+}
+
+func newFakeDiscord(msgs ...discord.Message) *fakeDiscord {
+	f := &fakeDiscord{
+		messages:     make(map[discord.MessageID]discord.Message),
+		channels:     make(map[discord.ChannelID]discord.Channel),
+		archived:     make(map[discord.ChannelID]bool),
+		locked:       make(map[discord.ChannelID]bool),
+		pageSize:     25,
+		deleteStatus: make(map[discord.MessageID]int),
+		files:        make(map[string][]byte),
+		cutOff:       make(map[string]bool),
+		deletes:      make(map[discord.MessageID]int),
+		nextID:       1 << 60,
+	}
+	for _, m := range msgs {
+		f.messages[m.ID] = m
+		typ := discord.GuildText
+		if !m.GuildID.IsValid() {
+			typ = discord.DirectMessage
+		}
+		f.channels[m.ChannelID] = discord.Channel{ID: m.ChannelID, GuildID: m.GuildID, Type: typ}
+	}
+	return f
+}
+
+// url returns the base URL f is served at until the test ends.
+func (f *fakeDiscord) url(t *testing.T) string {
+	if f.srv == nil {
+		f.srv = httptest.NewServer(f)
+		t.Cleanup(f.srv.Close)
+	}
+	return f.srv.URL
+}
+
+// attach adds an attachment served by f to the message id.
+func (f *fakeDiscord) attach(t *testing.T, id discord.MessageID, name string, data []byte) {
+	m := f.messages[id]
+	m.Attachments = append(m.Attachments, discord.Attachment{
+		Filename: name,
+		Size:     uint64(len(data)),
+		URL:      f.url(t) + "/attachments/" + name,
+	})
+	f.messages[id] = m
+	f.files[name] = data
+}
+
+// run runs discorddel with args against f, as testSelf, and returns what it
+// logged.
+func (f *fakeDiscord) run(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := f.runErr(t, args...)
+	if err != nil {
+		t.Fatalf("discorddel %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+// runErr is like run, but returns the error of a run that fails.
+func (f *fakeDiscord) runErr(t *testing.T, args ...string) (string, error) {
+	args = append([]string{"-token", "token", "-api-base", f.url(t)}, args...)
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "DISCORDDEL_TEST_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// left returns the IDs of the messages that weren't deleted.
+func (f *fakeDiscord) left() []discord.MessageID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []discord.MessageID
+	for id := range f.messages {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (f *fakeDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/gateway/ws" {
+		serveGateway(w, r)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if name := strings.TrimPrefix(r.URL.Path, "/attachments/"); name != r.URL.Path {
+		data, ok := f.files[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if f.cutOff[name] {
+			delete(f.cutOff, name)
+			w.Write(data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(data)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, api.Path), "/"), "/")
+	switch {
+	case r.Method == "GET" && len(parts) == 1 && parts[0] == "gateway":
+		writeJSON(w, http.StatusOK, map[string]string{"url": "ws://" + r.Host + "/gateway/ws"})
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "users" && parts[1] == "@me":
+		writeJSON(w, http.StatusOK, discord.User{ID: testSelf, Username: "me"})
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "channels":
+		ch, ok := f.channels[discord.ChannelID(parseID(parts[1]))]
+		if !ok {
+			writeError(w, http.StatusNotFound, 10003)
+			return
+		}
+		writeJSON(w, http.StatusOK, ch)
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "channels" && parts[2] == "messages":
+		writeJSON(w, http.StatusOK, f.messagesAfter(
+			discord.ChannelID(parseID(parts[1])),
+			discord.MessageID(parseID(r.URL.Query().Get("after"))),
+			int(parseID(r.URL.Query().Get("limit"))),
+		))
+	case r.Method == "GET" && len(parts) == 4 && parts[2] == "messages" && parts[3] == "search":
+		q := r.URL.Query()
+		params := searchParams{
+			authorID:  discord.UserID(parseID(q.Get("author_id"))),
+			channelID: discord.ChannelID(parseID(q.Get("channel_id"))),
+			minID:     discord.MessageID(parseID(q.Get("min_id"))),
+			maxID:     discord.MessageID(parseID(q.Get("max_id"))),
+			cursor:    q.Get("cursor"),
+		}
+		if parts[0] == "guilds" {
+			params.guildID = discord.GuildID(parseID(parts[1]))
+		} else {
+			params.channelID = discord.ChannelID(parseID(parts[1]))
+		}
+		f.searches++
+		search := f.search
+		if search == nil {
+			search = f.searchPage
+		}
+		writeJSON(w, http.StatusOK, search(params))
+	case r.Method == "DELETE" && len(parts) == 4 && parts[0] == "channels" && parts[2] == "messages":
+		chid := discord.ChannelID(parseID(parts[1]))
+		id := discord.MessageID(parseID(parts[3]))
+		f.deletes[id]++
+		if f.archived[chid] {
+			writeError(w, http.StatusBadRequest, InvalidActionOnArchivedThread)
+			return
+		}
+		m, ok := f.messages[id]
+		if !ok || m.ChannelID != chid {
+			writeError(w, http.StatusNotFound, UnknownMessage)
+			return
+		}
+		delete(f.messages, id)
+		if status, ok := f.deleteStatus[id]; ok {
+			delete(f.deleteStatus, id)
+			w.Header().Set("Retry-After", "0")
+			writeError(w, status, 0)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && len(parts) == 3 && parts[0] == "channels" && parts[2] == "messages":
+		chid := discord.ChannelID(parseID(parts[1]))
+		if f.locked[chid] {
+			writeError(w, http.StatusBadRequest, InvalidActionOnArchivedThread)
+			return
+		}
+		var data api.SendMessageData
+		json.NewDecoder(r.Body).Decode(&data)
+		f.nextID++
+		f.sent++
+		m := discord.Message{ID: f.nextID, ChannelID: chid, Author: discord.User{ID: testSelf}, Content: data.Content}
+		f.messages[m.ID] = m
+		delete(f.archived, chid)
+		writeJSON(w, http.StatusOK, m)
+	default:
+		writeError(w, http.StatusNotFound, 0)
+	}
+}
+
+// messagesAfter returns the first limit messages of a channel after an ID,
+// newest first.
+func (f *fakeDiscord) messagesAfter(chid discord.ChannelID, after discord.MessageID, limit int) []discord.Message {
+	found := []discord.Message{}
+	for _, m := range f.messages {
+		if m.ChannelID == chid && m.ID > after {
+			found = append(found, m)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+		found[i], found[j] = found[j], found[i]
+	}
+	return found
+}
+
+// searchPage returns the messages matching q, oldest first, a page at a
+// time, paged by ID.
+func (f *fakeDiscord) searchPage(q searchParams) searchPage {
+	var found []discord.Message
+	for _, m := range f.messages {
+		switch {
+		case q.authorID.IsValid() && m.Author.ID != q.authorID:
+		case q.guildID.IsValid() && m.GuildID != q.guildID:
+		case q.channelID.IsValid() && m.ChannelID != q.channelID:
+		case q.minID.IsValid() && m.ID < q.minID:
+		case q.maxID.IsValid() && m.ID >= q.maxID:
+		default:
+			found = append(found, m)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	var page searchPage
+	page.TotalResults = uint(len(found))
+	for i, m := range found {
+		if i == f.pageSize {
+			break
+		}
+		// Search results don't carry a guild ID.
+		m.GuildID = 0
+		page.Messages = append(page.Messages, []discord.Message{m})
+	}
+	return page
+}
+
+var upgrader websocket.Upgrader
+
+// serveGateway answers just enough of the gateway protocol for a client to
+// connect and stay connected: the hello, heartbeats, and the ready event.
+func serveGateway(w http.ResponseWriter, r *http.Request) {
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	type payload struct {
+		Op       int         `json:"op"`
+		Data     interface{} `json:"d,omitempty"`
+		Sequence int         `json:"s,omitempty"`
+		Type     string      `json:"t,omitempty"`
+	}
+	c.WriteJSON(payload{Op: 10, Data: map[string]int{"heartbeat_interval": 40000}})
+	for {
+		var p payload
+		if err := c.ReadJSON(&p); err != nil {
+			return
+		}
+		switch p.Op {
+		case 1:
+			c.WriteJSON(payload{Op: 11})
+		case 2:
+			c.WriteJSON(payload{Op: 0, Sequence: 1, Type: "READY", Data: map[string]interface{}{
+				"v":          9,
+				"user":       discord.User{ID: testSelf, Username: "me"},
+				"session_id": "session",
+				"guilds":     []interface{}{},
+			}})
+		}
+	}
+}
+
+func parseID(s string) discord.Snowflake {
+	id, _ := strconv.ParseUint(s, 10, 64)
+	return discord.Snowflake(id)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code httputil.ErrorCode) {
+	writeJSON(w, status, map[string]interface{}{"code": code, "message": http.StatusText(status)})
+}
+
+// testMessage returns a message by author in a guild channel.
+func testMessage(id discord.MessageID, gid discord.GuildID, chid discord.ChannelID, author discord.UserID, content string) discord.Message {
+	return discord.Message{
+		ID:        id,
+		GuildID:   gid,
+		ChannelID: chid,
+		Author:    discord.User{ID: author},
+		Content:   content,
+		Timestamp: discord.NewTimestamp(id.Time()),
+	}
+}
@@ -0,0 +1,757 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// A filter reports whether a message satisfies some condition.
+type filter func(m discord.Message) bool
+
+// filters is a set of filters, combined either with anyOf or allOf.
+type filters []filter
+
+// anyOf reports whether m satisfies at least one of the filters.
+func (fs filters) anyOf(m discord.Message) bool {
+	for _, f := range fs {
+		if f(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// allOf reports whether m satisfies every filter. An empty set of filters
+// matches everything.
+func (fs filters) allOf(m discord.Message) bool {
+	for _, f := range fs {
+		if !f(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// channelKindIs matches messages sent in channels of one of the given kinds.
+// Messages whose channel can't be resolved don't match.
+func channelKindIs(k *chanKinds, kinds []string) filter {
+	return func(m discord.Message) bool {
+		kind, err := k.kind(m.ChannelID)
+		if err != nil {
+			log.Printf("Warning: couldn't resolve the channel of %s: %s\n", m.URL(), err)
+			return false
+		}
+		for _, want := range kinds {
+			if kind == want {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func contentMatches(re *regexp.Regexp) filter {
+	return func(m discord.Message) bool {
+		return re.MatchString(m.Content)
+	}
+}
+
+func containsWord(wm *wordMatcher) filter {
+	return func(m discord.Message) bool {
+		return wm.matches(m.Content)
+	}
+}
+
+func hasAttachments(m discord.Message) bool {
+	return len(m.Attachments) > 0
+}
+
+func hasEmbeds(m discord.Message) bool {
+	return len(m.Embeds) > 0
+}
+
+// contentLength matches messages whose trimmed content is between min and
+// max characters long. A zero max doesn't bound the length.
+func contentLength(min, max int) filter {
+	return func(m discord.Message) bool {
+		n := utf8.RuneCountInString(strings.TrimSpace(m.Content))
+		return n >= min && (max == 0 || n <= max)
+	}
+}
+
+// contentHash returns the hex SHA-256 hash of content after collapsing
+// whitespace, so that reposts of the same text hash the same.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(content), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+var sha256Re = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func contentHashIs(hash string) filter {
+	return func(m discord.Message) bool {
+		return contentHash(m.Content) == hash
+	}
+}
+
+// linkRe matches the links in message content.
+var linkRe = regexp.MustCompile(`https?://[^\s<>]+`)
+
+// linksTo matches messages whose embeds or content link to domain or one of
+// its subdomains.
+func linksTo(domain string) filter {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	matches := func(link string) bool {
+		u, err := url.Parse(link)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		return host == domain || strings.HasSuffix(host, "."+domain)
+	}
+	return func(m discord.Message) bool {
+		for _, e := range m.Embeds {
+			if e.URL != "" && matches(e.URL) {
+				return true
+			}
+		}
+		for _, link := range linkRe.FindAllString(m.Content, -1) {
+			if matches(link) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// sentBetween matches messages sent after after and before before. Zero
+// times don't bound the window.
+func sentBetween(after, before time.Time) filter {
+	return func(m discord.Message) bool {
+		sent := m.ID.Time()
+		return (after.IsZero() || sent.After(after)) && (before.IsZero() || sent.Before(before))
+	}
+}
+
+// idBetween matches messages with IDs from min to max. Zero IDs don't bound
+// the range.
+func idBetween(min, max discord.MessageID) filter {
+	return func(m discord.Message) bool {
+		return m.ID >= min && (!max.IsValid() || m.ID <= max)
+	}
+}
+
+// parseTimeRange parses a range of times of day like 01:00-06:00 into
+// minutes since midnight.
+func parseTimeRange(s string) (from, to int, err error) {
+	fromStr, toStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q isn't a range like 01:00-06:00", s)
+	}
+	for _, x := range []struct {
+		s string
+		m *int
+	}{{fromStr, &from}, {toStr, &to}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(x.s))
+		if err != nil {
+			return 0, 0, fmt.Errorf("%q isn't a time like 06:00", x.s)
+		}
+		*x.m = t.Hour()*60 + t.Minute()
+	}
+	return from, to, nil
+}
+
+// sentDuring matches messages sent from the minute of the day from until
+// the minute to, in loc. If to is before from, the range wraps past
+// midnight.
+func sentDuring(from, to int, loc *time.Location) filter {
+	return func(m discord.Message) bool {
+		t := m.Timestamp.Time().In(loc)
+		minute := t.Hour()*60 + t.Minute()
+		if from <= to {
+			return from <= minute && minute < to
+		}
+		return minute >= from || minute < to
+	}
+}
+
+// weekdays are the days -weekdays accepts.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// sentOn matches messages sent on the days, in loc, or if on isn't set,
+// on any other day.
+func sentOn(days map[time.Weekday]bool, on bool, loc *time.Location) filter {
+	return func(m discord.Message) bool {
+		return days[m.Timestamp.Time().In(loc).Weekday()] == on
+	}
+}
+
+func reactionsAtLeast(n int) filter {
+	return func(m discord.Message) bool {
+		total := 0
+		for _, r := range m.Reactions {
+			total += r.Count
+		}
+		return total >= n
+	}
+}
+
+// reactedWith matches messages the user reacted to with the emoji named
+// emoji.
+func reactedWith(emoji string) filter {
+	return func(m discord.Message) bool {
+		for _, r := range m.Reactions {
+			if r.Me && r.Emoji.Name == emoji {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// dmWith reports whether ch is a DM or group DM with any of the users.
+func dmWith(ch discord.Channel, users snowflakes) bool {
+	for _, u := range ch.DMRecipients {
+		if users.contains(discord.Snowflake(u.ID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// notDMWith matches messages in guilds and in DMs without any of the users.
+// Messages whose DM can't be resolved don't match, to be safe.
+func notDMWith(k *chanKinds, users snowflakes) filter {
+	return func(m discord.Message) bool {
+		if m.GuildID.IsValid() {
+			return true
+		}
+		ch, err := k.channel(m.ChannelID)
+		if err != nil {
+			log.Printf("Warning: couldn't resolve the channel of %s, skipping it: %s\n", m.URL(), err)
+			return false
+		}
+		return !dmWith(ch, users)
+	}
+}
+
+// mentionsUser matches messages mentioning the user id.
+func mentionsUser(id discord.UserID) filter {
+	return func(m discord.Message) bool {
+		for _, u := range m.Mentions {
+			if u.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// mentionsRole matches messages mentioning the role id.
+func mentionsRole(id discord.RoleID) filter {
+	return func(m discord.Message) bool {
+		for _, r := range m.MentionRoleIDs {
+			if r == id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func mentionsEveryone(m discord.Message) bool {
+	return m.MentionEveryone
+}
+
+// channelNotIn matches messages sent outside of the channels ids.
+func channelNotIn(ids snowflakes) filter {
+	return func(m discord.Message) bool {
+		return !ids.contains(discord.Snowflake(m.ChannelID))
+	}
+}
+
+// messageKinds are the kinds of messages -types accepts.
+var messageKinds = []string{"default", "reply", "command", "system"}
+
+// messageKind returns the kind of m, one of messageKinds.
+func messageKind(m discord.Message) string {
+	switch m.Type {
+	case discord.DefaultMessage:
+		return "default"
+	case discord.InlinedReplyMessage:
+		return "reply"
+	case discord.ChatInputCommandMessage, discord.ContextMenuCommand:
+		return "command"
+	}
+	return "system"
+}
+
+// messageKindIn matches messages of the kinds in only, or of any kind if
+// only is empty, that aren't of the kinds in skip.
+func messageKindIn(only, skip []string) filter {
+	return func(m discord.Message) bool {
+		kind := messageKind(m)
+		return (len(only) == 0 || contains(only, kind)) && !contains(skip, kind)
+	}
+}
+
+// latestCache finds and caches the oldest of the user's latest n messages
+// in channels.
+type latestCache struct {
+	n int
+	// fetch fetches the IDs of the user's latest n messages in a channel,
+	// newest first. Without it, as when checking the archive offline, no
+	// message is known to be among the latest.
+	fetch   func(discord.GuildID, discord.ChannelID, int) ([]discord.MessageID, error)
+	cutoffs map[discord.ChannelID]discord.MessageID
+}
+
+// latest reports whether m is among the user's latest n messages in its
+// channel.
+func (c *latestCache) latest(m discord.Message) (bool, error) {
+	if c.fetch == nil {
+		return false, nil
+	}
+	cutoff, ok := c.cutoffs[m.ChannelID]
+	if !ok {
+		ids, err := c.fetch(m.GuildID, m.ChannelID, c.n)
+		if err != nil {
+			return false, err
+		}
+		if len(ids) > 0 {
+			cutoff = ids[len(ids)-1]
+		}
+		if c.cutoffs == nil {
+			c.cutoffs = make(map[discord.ChannelID]discord.MessageID)
+		}
+		c.cutoffs[m.ChannelID] = cutoff
+	}
+	return cutoff.IsValid() && m.ID >= cutoff, nil
+}
+
+// isLatest matches the user's latest messages in each channel, and messages
+// whose channel's latest messages can't be found, to be safe.
+func isLatest(c *latestCache) filter {
+	return func(m discord.Message) bool {
+		latest, err := c.latest(m)
+		if err != nil {
+			log.Printf("Warning: couldn't find your latest messages in %s, treating %s as one of them: %s\n", chanURL(m.GuildID, m.ChannelID), m.URL(), err)
+			return true
+		}
+		return latest
+	}
+}
+
+// repliedTo matches messages that others replied to, and messages whose
+// replies can't be looked for, to be safe.
+func repliedTo(f *replyFinder) filter {
+	return func(m discord.Message) bool {
+		replied, err := f.repliedTo(m)
+		if err != nil {
+			log.Printf("Warning: couldn't look for replies to %s, treating it as replied to: %s\n", m.URL(), err)
+			return true
+		}
+		return replied
+	}
+}
+
+// pinCache fetches and caches the pinned messages of channels.
+type pinCache struct {
+	// fetch fetches the pinned messages of a channel. Without it, as when
+	// checking the archive offline, only the messages' own pinned flags
+	// are known.
+	fetch func(discord.ChannelID) ([]discord.Message, error)
+	pins  map[discord.ChannelID]map[discord.MessageID]bool
+}
+
+// pinned reports whether m is pinned in its channel.
+func (c *pinCache) pinned(m discord.Message) (bool, error) {
+	if c.fetch == nil {
+		return false, nil
+	}
+	pins, ok := c.pins[m.ChannelID]
+	if !ok {
+		ms, err := c.fetch(m.ChannelID)
+		if err != nil {
+			return false, err
+		}
+		pins = make(map[discord.MessageID]bool, len(ms))
+		for _, pin := range ms {
+			pins[pin.ID] = true
+		}
+		if c.pins == nil {
+			c.pins = make(map[discord.ChannelID]map[discord.MessageID]bool)
+		}
+		c.pins[m.ChannelID] = pins
+	}
+	return pins[m.ID], nil
+}
+
+// isPinned matches pinned messages, and messages whose channel's pins can't
+// be fetched, to be safe.
+func isPinned(c *pinCache) filter {
+	return func(m discord.Message) bool {
+		if m.Pinned {
+			return true
+		}
+		pinned, err := c.pinned(m)
+		if err != nil {
+			log.Printf("Warning: couldn't fetch the pins of %s, treating %s as pinned: %s\n", chanURL(m.GuildID, m.ChannelID), m.URL(), err)
+			return true
+		}
+		return pinned
+	}
+}
+
+// unengaged matches messages without reactions that others didn't reply
+// to. Messages whose replies can't be looked for are taken as engaged with,
+// to be safe.
+func unengaged(f *replyFinder) filter {
+	replied := repliedTo(f)
+	return func(m discord.Message) bool {
+		return len(m.Reactions) == 0 && !replied(m)
+	}
+}
+
+// policy decides which of the user's messages are deleted.
+type policy struct {
+	// include selects the messages to act on. Messages that don't satisfy
+	// all of them are neither archived nor deleted.
+	include filters
+	// keep protects messages from deletion. It takes precedence over
+	// include: a kept message is still archived, but never deleted.
+	keep filters
+	// after and before, if set, bound the window searched for messages.
+	after, before time.Time
+	// minID and maxID, if set, bound the IDs of the messages searched for,
+	// inclusively.
+	minID, maxID discord.MessageID
+	// replyFinder, if set, looks for replies to messages, once its fetch
+	// func and self are set.
+	replyFinder *replyFinder
+	// pins, if set, holds the pinned messages of the channels the policy
+	// has seen. It fetches pins once its fetch func is set.
+	pins *pinCache
+	// latest, if set, holds the oldest of the latest messages to keep in
+	// the channels the policy has seen, once its fetch func is set.
+	latest *latestCache
+	// sample, if set, picks the messages to delete among those that would
+	// otherwise be deleted, once its self is set.
+	sample *sampler
+	// kinds, if set, resolves the channel kinds the policy filters by,
+	// once its fetch func is set.
+	kinds *chanKinds
+	// mentions and mentionsEveryone narrow down the search to messages
+	// mentioning a user or everyone, for the filter of -mentions.
+	mentions         discord.UserID
+	mentionsEveryone bool
+}
+
+// shouldDelete reports whether m should be deleted, and whether it should be
+// acted on at all.
+func (p *policy) shouldDelete(m discord.Message) (del, include bool) {
+	if !p.include.allOf(m) {
+		return false, false
+	}
+	if p.keep.anyOf(m) {
+		return false, true
+	}
+	// The sample is picked among the messages that would otherwise be
+	// deleted, and those left out are treated as not included.
+	if p.sample != nil && !p.sample.pick(m) {
+		return false, false
+	}
+	return true, true
+}
+
+// policyFlags are the command-line flags that make up a policy.
+type policyFlags struct {
+	after        date
+	before       date
+	minID        uint64
+	maxID        uint64
+	keepDays     int
+	between      string
+	weekdays     string
+	timezone     string
+	sample       string
+	match        string
+	wordlist     string
+	attachments  bool
+	embeds       bool
+	minLen       int
+	maxLen       int
+	skipPinned   bool
+	minReactions int
+	skipReplied  bool
+	keepReaction string
+	keepLatest   int
+	keepMatch    string
+	contentHash  string
+	embedDomain  string
+	unengaged    bool
+	types        string
+	// excludeChannels are the channels never touched.
+	excludeChannels snowflakes
+	skipThreads     bool
+	mentions        string
+	// excludeUsers are the users whose DMs are never touched.
+	excludeUsers snowflakes
+	channelTypes string
+}
+
+// register registers the filter flags on fs.
+func (f *policyFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.after, "after", "Only delete messages sent after this date, like 2006-01-02 or 2006-01-02T15:04:05Z")
+	fs.Var(&f.before, "before", "Only delete messages sent before this date, like 2006-01-02 or 2006-01-02T15:04:05Z")
+	fs.Uint64Var(&f.minID, "min-id", 0, "Only delete messages with at least this ID")
+	fs.Uint64Var(&f.maxID, "max-id", 0, "Only delete messages with at most this ID")
+	fs.IntVar(&f.keepDays, "keep-days", 0, "Only delete messages older than this many days, counted back from the start of the run")
+	fs.StringVar(&f.between, "between", "", "Only delete messages sent between these times of day, like 01:00-06:00; the range may wrap past midnight")
+	fs.StringVar(&f.weekdays, "weekdays", "", "Only delete messages sent on these comma-separated days, like sat,sun, or not on those prefixed with -")
+	fs.StringVar(&f.timezone, "timezone", "Local", "Time zone of -between and -weekdays, such as UTC or Europe/Berlin")
+	fs.StringVar(&f.sample, "sample", "", "Only delete a random sample of the messages that would otherwise be deleted, either this many or a percentage like 10%; a number takes a first pass over the targets to count their messages, and can't be used with -stdin, -select, -data-package and -from-archive")
+	fs.StringVar(&f.match, "match", "", "Only archive and delete messages whose content matches this regular expression")
+	fs.StringVar(&f.wordlist, "wordlist", "", "Only delete messages containing one of the words or phrases in this file, one per line")
+	fs.BoolVar(&f.attachments, "attachments-only", false, "Only delete messages with attachments")
+	fs.BoolVar(&f.embeds, "embeds-only", false, "Only delete messages with embeds, such as link previews")
+	fs.IntVar(&f.minLen, "min-len", 0, "Only delete messages with at least this many characters, not counting surrounding whitespace")
+	fs.IntVar(&f.maxLen, "max-len", 0, "Only delete messages with at most this many characters, not counting surrounding whitespace")
+	fs.BoolVar(&f.skipPinned, "skip-pinned", false, "Archive but never delete pinned messages")
+	fs.IntVar(&f.minReactions, "min-reactions-keep", 0, "Archive but never delete messages with at least this many reactions in total")
+	fs.BoolVar(&f.skipReplied, "skip-replied", false, "Archive but never delete messages that others replied to within the next 100 messages of the channel")
+	fs.StringVar(&f.keepReaction, "keep-reaction", "", "Archive but never delete messages you reacted to with this emoji, given as the emoji itself or the name of a custom emoji")
+	fs.IntVar(&f.keepLatest, "keep-latest", 0, "Archive but never delete your latest this many messages in each channel")
+	fs.StringVar(&f.keepMatch, "keep-match", "", "Archive but never delete messages whose content matches this regular expression")
+	fs.StringVar(&f.contentHash, "content-hash", "", "Only delete messages with this content, given as text or as the hex SHA-256 hash of the text with whitespace collapsed")
+	fs.StringVar(&f.embedDomain, "embed-domain", "", "Only delete messages whose embeds or links point to this domain or its subdomains")
+	fs.BoolVar(&f.unengaged, "only-unengaged", false, "Only delete messages without reactions that others didn't reply to within the next 100 messages of the channel")
+	fs.StringVar(&f.types, "types", "", "Only delete messages of these comma-separated types, or not of those prefixed with -: "+strings.Join(messageKinds, ", "))
+	fs.Var(&f.excludeChannels, "exclude-channels", "Comma-separated list of channel IDs whose messages must never be touched")
+	fs.BoolVar(&f.skipThreads, "skip-threads", false, "Never delete messages in threads or forum posts, so that archived threads are never unarchived")
+	fs.StringVar(&f.mentions, "mentions", "", "Only delete messages mentioning this user ID, role ID given as role:<id>, or everyone")
+	fs.Var(&f.excludeUsers, "exclude-users", "Comma-separated list of user IDs whose DMs and group DMs must never be touched")
+	fs.StringVar(&f.channelTypes, "channel-type", "", "Only delete messages in channels of these comma-separated types, voice including stage channels: "+strings.Join(channelKinds, ", "))
+}
+
+func (f *policyFlags) policy() (*policy, error) {
+	p := new(policy)
+	p.after, p.before = time.Time(f.after), time.Time(f.before)
+	if f.keepDays < 0 {
+		return nil, errors.New("-keep-days must not be negative")
+	}
+	if f.keepDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -f.keepDays)
+		if p.before.IsZero() || cutoff.Before(p.before) {
+			p.before = cutoff
+		}
+	}
+	if !p.after.IsZero() && !p.before.IsZero() && !p.after.Before(p.before) {
+		return nil, errors.New("-after must be earlier than -before and -keep-days")
+	}
+	if !p.after.IsZero() || !p.before.IsZero() {
+		p.include = append(p.include, sentBetween(p.after, p.before))
+	}
+	p.minID, p.maxID = discord.MessageID(f.minID), discord.MessageID(f.maxID)
+	if p.maxID.IsValid() && p.minID > p.maxID {
+		return nil, errors.New("-min-id must be no more than -max-id")
+	}
+	if p.minID.IsValid() || p.maxID.IsValid() {
+		p.include = append(p.include, idBetween(p.minID, p.maxID))
+	}
+	loc, err := time.LoadLocation(f.timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -timezone: %w", err)
+	}
+	if f.between != "" {
+		from, to, err := parseTimeRange(f.between)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -between: %w", err)
+		}
+		p.include = append(p.include, sentDuring(from, to, loc))
+	}
+	if f.weekdays != "" {
+		days := make(map[time.Weekday]bool)
+		skip := strings.HasPrefix(strings.TrimSpace(f.weekdays), "-")
+		for _, day := range strings.Split(f.weekdays, ",") {
+			day = strings.ToLower(strings.TrimSpace(day))
+			if strings.HasPrefix(day, "-") != skip {
+				return nil, errors.New("invalid -weekdays, either all or none of the days must be prefixed with -")
+			}
+			wd, ok := weekdays[strings.TrimPrefix(day, "-")]
+			if !ok {
+				return nil, fmt.Errorf("invalid -weekdays day %q, must be one of mon, tue, wed, thu, fri, sat, sun", day)
+			}
+			days[wd] = true
+		}
+		p.include = append(p.include, sentOn(days, !skip, loc))
+	}
+	if f.match != "" {
+		re, err := regexp.Compile(f.match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -match expression: %w", err)
+		}
+		p.include = append(p.include, contentMatches(re))
+	}
+	if f.attachments {
+		p.include = append(p.include, hasAttachments)
+	}
+	if f.embeds {
+		p.include = append(p.include, hasEmbeds)
+	}
+	if f.minLen < 0 || f.maxLen < 0 || f.maxLen > 0 && f.minLen > f.maxLen {
+		return nil, errors.New("-min-len and -max-len must be positive, and -min-len no more than -max-len")
+	}
+	if f.minLen > 0 || f.maxLen > 0 {
+		p.include = append(p.include, contentLength(f.minLen, f.maxLen))
+	}
+	if f.skipPinned {
+		p.pins = new(pinCache)
+		p.keep = append(p.keep, isPinned(p.pins))
+	}
+	if f.minReactions > 0 {
+		p.keep = append(p.keep, reactionsAtLeast(f.minReactions))
+	}
+	if f.keepLatest < 0 {
+		return nil, errors.New("-keep-latest must be positive")
+	}
+	if f.keepLatest > 0 {
+		p.latest = &latestCache{n: f.keepLatest}
+		p.keep = append(p.keep, isLatest(p.latest))
+	}
+	if f.skipReplied || f.unengaged {
+		p.replyFinder = new(replyFinder)
+	}
+	if f.skipReplied {
+		p.keep = append(p.keep, repliedTo(p.replyFinder))
+	}
+	if f.keepReaction != "" {
+		p.keep = append(p.keep, reactedWith(strings.Trim(f.keepReaction, ":")))
+	}
+	if f.wordlist != "" {
+		wm, err := readWordlist(f.wordlist)
+		if err != nil {
+			return nil, fmt.Errorf("reading -wordlist: %w", err)
+		}
+		p.include = append(p.include, containsWord(wm))
+	}
+	if f.keepMatch != "" {
+		re, err := regexp.Compile(f.keepMatch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -keep-match expression: %w", err)
+		}
+		p.keep = append(p.keep, contentMatches(re))
+	}
+	if f.contentHash != "" {
+		hash := strings.ToLower(f.contentHash)
+		if !sha256Re.MatchString(hash) {
+			hash = contentHash(f.contentHash)
+		}
+		p.include = append(p.include, contentHashIs(hash))
+	}
+	if f.embedDomain != "" {
+		p.include = append(p.include, linksTo(f.embedDomain))
+	}
+	if f.unengaged {
+		p.include = append(p.include, unengaged(p.replyFinder))
+	}
+	if f.types != "" {
+		var only, skip []string
+		for _, kind := range strings.Split(f.types, ",") {
+			kind = strings.TrimSpace(kind)
+			list := &only
+			if strings.HasPrefix(kind, "-") {
+				kind, list = kind[1:], &skip
+			}
+			if !contains(messageKinds, kind) {
+				return nil, fmt.Errorf("invalid -types %q, must be one of %s", kind, strings.Join(messageKinds, ", "))
+			}
+			*list = append(*list, kind)
+		}
+		p.include = append(p.include, messageKindIn(only, skip))
+	}
+	if len(f.excludeChannels) > 0 {
+		p.include = append(p.include, channelNotIn(f.excludeChannels))
+	}
+	if f.channelTypes != "" {
+		var kinds []string
+		for _, kind := range strings.Split(f.channelTypes, ",") {
+			kind = strings.TrimSpace(kind)
+			if !contains(channelKinds, kind) {
+				return nil, fmt.Errorf("invalid -channel-type %q, must be one of %s", kind, strings.Join(channelKinds, ", "))
+			}
+			kinds = append(kinds, kind)
+		}
+		p.kinds = new(chanKinds)
+		p.include = append(p.include, channelKindIs(p.kinds, kinds))
+	}
+	if f.mentions != "" {
+		switch role := strings.TrimPrefix(f.mentions, "role:"); {
+		case f.mentions == "everyone":
+			p.mentionsEveryone = true
+			p.include = append(p.include, mentionsEveryone)
+		case role != f.mentions:
+			id, err := discord.ParseSnowflake(role)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -mentions role: %w", err)
+			}
+			p.include = append(p.include, mentionsRole(discord.RoleID(id)))
+		default:
+			id, err := discord.ParseSnowflake(f.mentions)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -mentions user: %w", err)
+			}
+			p.mentions = discord.UserID(id)
+			p.include = append(p.include, mentionsUser(p.mentions))
+		}
+	}
+	if len(f.excludeUsers) > 0 {
+		if p.kinds == nil {
+			p.kinds = new(chanKinds)
+		}
+		p.include = append(p.include, notDMWith(p.kinds, f.excludeUsers))
+	}
+	if f.skipThreads {
+		if p.kinds == nil {
+			p.kinds = new(chanKinds)
+		}
+		p.include = append(p.include, channelKindIs(p.kinds, []string{"text", "voice"}))
+	}
+	if f.sample != "" {
+		sm, err := parseSample(f.sample)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -sample: %w", err)
+		}
+		p.sample = sm
+	}
+	return p, nil
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// snowflakes is a flag.Value accepting a comma-separated list of IDs. The
+// flag may also be repeated.
+type snowflakes []discord.Snowflake
+
+func (s *snowflakes) String() string {
+	if s == nil {
+		return ""
+	}
+	strs := make([]string, len(*s))
+	for i, id := range *s {
+		strs[i] = id.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+func (s *snowflakes) Set(v string) error {
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		id, err := discord.ParseSnowflake(f)
+		if err != nil {
+			return err
+		}
+		*s = append(*s, id)
+	}
+	return nil
+}
+
+func (s snowflakes) contains(id discord.Snowflake) bool {
+	for _, x := range s {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// fileMode is a flag.Value accepting file permissions in octal.
+type fileMode os.FileMode
+
+func (m *fileMode) String() string {
+	return "0" + strconv.FormatUint(uint64(*m), 8)
+}
+
+func (m *fileMode) Set(v string) error {
+	n, err := strconv.ParseUint(v, 8, 32)
+	if err != nil {
+		return err
+	}
+	*m = fileMode(n) & fileMode(os.ModePerm)
+	return nil
+}
+
+// date is a flag.Value accepting a date, optionally with a time, in UTC
+// unless the time has an offset.
+type date time.Time
+
+var dateLayouts = []string{"2006-01-02", "2006-01-02T15:04:05", time.RFC3339}
+
+func (d *date) String() string {
+	if d == nil || time.Time(*d).IsZero() {
+		return ""
+	}
+	return time.Time(*d).Format(time.RFC3339)
+}
+
+func (d *date) Set(v string) error {
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, v)
+		if err == nil {
+			*d = date(t)
+			return nil
+		}
+	}
+	return fmt.Errorf("%q isn't a date like 2006-01-02 or 2006-01-02T15:04:05Z", v)
+}
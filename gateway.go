@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/session"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// gatewayAttempts is how many times the gateway tries to reconnect before
+// giving up.
+const gatewayAttempts = 10
+
+// watchGateway logs the gateway's disconnections and reconnections. The
+// returned channel receives an error once the gateway gives up reconnecting.
+// Handlers added to the session survive reconnections, so the pause keeps
+// working until then.
+func watchGateway(ctx context.Context, c *session.Session) <-chan error {
+	c.AddHandler(func(e *ws.CloseEvent) {
+		log.Println("Gateway disconnected:", e)
+	})
+	c.AddHandler(func(e *ws.BackgroundErrorEvent) {
+		var cerr ws.ConnectionError
+		if errors.As(e, &cerr) {
+			log.Println("Gateway failed to reconnect:", cerr.Err)
+		}
+	})
+	c.AddHandler(func(*gateway.ReadyEvent) {
+		log.Println("Gateway reconnected")
+	})
+	c.AddHandler(func(*gateway.ResumedEvent) {
+		log.Println("Gateway reconnected")
+	})
+	dead := make(chan error, 1)
+	go func() {
+		err := c.Wait(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("gateway closed")
+		}
+		dead <- err
+	}()
+	return dead
+}
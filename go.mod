@@ -1,14 +1,14 @@
 module samhza.com/discorddel
 
-go 1.17
+go 1.18
 
 require (
 	github.com/diamondburned/arikawa/v3 v3.3.7-0.20240714074659-231b4759dc81
+	github.com/gorilla/websocket v1.5.3
 	github.com/mattn/go-sqlite3 v1.14.22
 )
 
 require (
 	github.com/gorilla/schema v1.4.1 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 	golang.org/x/time v0.5.0 // indirect
 )
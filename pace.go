@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+)
+
+const (
+	// paceStep is the smallest delay added after a 429, and the delay taken
+	// off after a streak of successful deletions.
+	paceStep = 250 * time.Millisecond
+	// paceStreak is how many deletions in a row must succeed before the
+	// delay is shortened.
+	paceStreak = 10
+)
+
+// pacer adapts the delay between deletions to the rate limits hit, doubling
+// it on every 429 and shortening it after a streak of successes.
+type pacer struct {
+	mu       sync.Mutex
+	delay    time.Duration
+	min, max time.Duration
+	streak   int
+	// edits makes the pacer only slow down for message edits, which
+	// Discord limits separately. Otherwise, they're left out.
+	edits bool
+}
+
+func newPacer(min, max time.Duration) *pacer {
+	if max < min {
+		max = min
+	}
+	return &pacer{delay: min, min: min, max: max}
+}
+
+// onResponse is an httputil.ResponseFunc that slows down on 429s.
+func (p *pacer) onResponse(r httpdriver.Request, resp httpdriver.Response) error {
+	if resp != nil && resp.GetStatus() == http.StatusTooManyRequests && isEdit(r) == p.edits {
+		p.slowDown()
+	}
+	return nil
+}
+
+func (p *pacer) slowDown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.streak = 0
+	p.delay *= 2
+	if p.delay < paceStep {
+		p.delay = paceStep
+	}
+	if p.delay > p.max {
+		p.delay = p.max
+	}
+}
+
+// succeeded records a successful deletion, or edit.
+func (p *pacer) succeeded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.streak++
+	if p.streak < paceStreak {
+		return
+	}
+	p.streak = 0
+	p.delay -= paceStep
+	if p.delay < p.min {
+		p.delay = p.min
+	}
+}
+
+// wait sleeps for the current delay.
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	d := p.delay
+	p.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
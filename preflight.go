@@ -0,0 +1,12 @@
+package main
+
+import "log"
+
+// checklist reports the checks that -preflight passed, if enabled.
+type checklist bool
+
+func (c checklist) ok(format string, v ...interface{}) {
+	if c {
+		log.Printf("ok: "+format+"\n", v...)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+)
+
+// chanLimits tracks rate limit backoff per channel, so that being throttled
+// in one channel doesn't hold up requests to the others.
+type chanLimits struct {
+	mu    sync.Mutex
+	until map[discord.ChannelID]time.Time
+	// edits makes only message edits be tracked, which Discord limits
+	// separately. Otherwise, they're left out.
+	edits bool
+}
+
+func newChanLimits() *chanLimits {
+	return &chanLimits{until: make(map[discord.ChannelID]time.Time)}
+}
+
+// onResponse is an httputil.ResponseFunc that records the X-RateLimit-*
+// headers of responses to channel routes.
+func (l *chanLimits) onResponse(r httpdriver.Request, resp httpdriver.Response) error {
+	if resp == nil {
+		return nil
+	}
+	if isEdit(r) != l.edits {
+		return nil
+	}
+	chid := pathChannel(r.GetPath())
+	if !chid.IsValid() {
+		return nil
+	}
+	h := resp.GetHeader()
+	var after time.Duration
+	switch {
+	case resp.GetStatus() == http.StatusTooManyRequests && h.Get("Retry-After") != "":
+		after = parseSeconds(h.Get("Retry-After"))
+	case h.Get("X-RateLimit-Remaining") == "0":
+		after = parseSeconds(h.Get("X-RateLimit-Reset-After"))
+	default:
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t := time.Now().Add(after); t.After(l.until[chid]) {
+		l.until[chid] = t
+	}
+	return nil
+}
+
+// wait blocks until the channel is no longer rate limited.
+func (l *chanLimits) wait(ctx context.Context, chid discord.ChannelID) error {
+	l.mu.Lock()
+	until, ok := l.until[chid]
+	if ok && !time.Now().Before(until) {
+		delete(l.until, chid)
+	}
+	l.mu.Unlock()
+	d := time.Until(until)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pathChannel extracts the channel ID from a request path such as
+// /api/v9/channels/123/messages/456, or returns the null ID.
+func pathChannel(p string) discord.ChannelID {
+	parts := strings.Split(p, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] != "channels" {
+			continue
+		}
+		id, err := discord.ParseSnowflake(parts[i+1])
+		if err != nil {
+			return discord.NullChannelID
+		}
+		return discord.ChannelID(id)
+	}
+	return discord.NullChannelID
+}
+
+// isEdit reports whether r edits something, as message edits do.
+func isEdit(r httpdriver.Request) bool {
+	hr, ok := r.(*httpdriver.DefaultRequest)
+	return ok && hr.Method == http.MethodPatch
+}
+
+func parseSeconds(s string) time.Duration {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+)
+
+// unreact removes the user's reactions in t, going through the whole
+// history of its channels since search can't find reactions. Channels in
+// skip are left alone.
+func (d *deleter) unreact(ctx context.Context, t target, skip snowflakes) error {
+	chs := []discord.ChannelID{t.channelID}
+	if !t.channelID.IsValid() {
+		all, err := guildChannels(d.c.Client, t.guildID)
+		if err != nil {
+			return fmt.Errorf("fetching channels of %s: %w", t, err)
+		}
+		chs = chs[:0]
+		for _, ch := range all {
+			if !skip.contains(discord.Snowflake(ch.ID)) {
+				chs = append(chs, ch.ID)
+			}
+		}
+	}
+	for _, chid := range chs {
+		if err := d.unreactIn(ctx, t.guildID, chid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unreactIn removes the user's reactions in a channel, within the dates of
+// the policy.
+func (d *deleter) unreactIn(ctx context.Context, gid discord.GuildID, chid discord.ChannelID) error {
+	var after discord.MessageID
+	if !d.policy.after.IsZero() {
+		after = discord.MessageID(discord.NewSnowflake(d.policy.after))
+	}
+	for {
+		if err := d.limits.wait(ctx, chid); err != nil {
+			return err
+		}
+		// Pages come newest first.
+		msgs, err := d.c.MessagesAfter(chid, after, 100)
+		if err != nil {
+			log.Printf("Skipping %s, its messages can't be read: %s\n", chanURL(gid, chid), err)
+			return nil
+		}
+		for i := len(msgs) - 1; i >= 0; i-- {
+			m := msgs[i]
+			if !d.policy.before.IsZero() && !m.ID.Time().Before(d.policy.before) {
+				return nil
+			}
+			after = m.ID
+			m.GuildID = gid
+			for _, r := range m.Reactions {
+				if !r.Me {
+					continue
+				}
+				if err := d.removeReaction(ctx, m, r.Emoji); err != nil {
+					return err
+				}
+			}
+		}
+		if len(msgs) < 100 {
+			return nil
+		}
+	}
+}
+
+// removeReaction removes the user's reaction with emoji from m, retrying on
+// rate limits and network errors. It returns an error if the run can't go
+// on.
+func (d *deleter) removeReaction(ctx context.Context, m discord.Message, emoji discord.Emoji) error {
+	if d.dryRun {
+		log.Printf("Would remove reaction %s from %s\n", emoji, m.URL())
+		d.stats.unreacted++
+		return nil
+	}
+	for tries := 0; ; {
+		if err := d.limits.wait(ctx, m.ChannelID); err != nil {
+			return err
+		}
+		if err := d.pacer.wait(ctx); err != nil {
+			return err
+		}
+		err := d.c.Unreact(m.ChannelID, m.ID, emoji.APIString())
+		var herr *httputil.HTTPError
+		switch {
+		case err == nil:
+			d.pacer.succeeded()
+			d.stats.unreacted++
+		case errors.As(err, &herr) && herr.Code == UnknownMessage:
+		case isRateLimited(err):
+			continue
+		case isNetworkError(err) && tries < maxRetries:
+			tries++
+			select {
+			case <-time.After(time.Duration(tries) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		case ctx.Err() != nil:
+			return ctx.Err()
+		default:
+			d.stats.failed++
+			d.stats.addError(err)
+			log.Printf("Error removing reaction %s from %s: %s\n", emoji, m.URL(), err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// replyLookahead is how many later messages of a channel are looked through
+// for replies to a message.
+const replyLookahead = 100
+
+// replyFinder looks for replies by others among the messages sent after a
+// message in its channel. The messages fetched for one message are reused
+// for the following ones as long as they reach far enough past them.
+type replyFinder struct {
+	// fetch fetches the messages after a message, newest first. Without
+	// it, as when checking the archive offline, no replies are found.
+	fetch func(discord.ChannelID, discord.MessageID, uint) ([]discord.Message, error)
+	// self is the user whose replies don't count.
+	self    discord.UserID
+	windows map[discord.ChannelID]*replyWindow
+}
+
+// replyWindow holds the messages fetched after a message of a channel.
+type replyWindow struct {
+	after discord.MessageID
+	// ids are the IDs of the messages, oldest first.
+	ids []discord.MessageID
+	// replied holds the messages replied to by others.
+	replied map[discord.MessageID]bool
+	// complete is set if the window reaches the end of the channel.
+	complete bool
+}
+
+// covers reports whether w has enough of the messages after id.
+func (w *replyWindow) covers(id discord.MessageID) bool {
+	if id < w.after {
+		return false
+	}
+	later := len(w.ids) - sort.Search(len(w.ids), func(i int) bool { return w.ids[i] > id })
+	return w.complete || later >= replyLookahead
+}
+
+// repliedTo reports whether others replied to m.
+func (f *replyFinder) repliedTo(m discord.Message) (bool, error) {
+	if f.fetch == nil {
+		return false, nil
+	}
+	w := f.windows[m.ChannelID]
+	if w == nil || !w.covers(m.ID) {
+		ms, err := f.fetch(m.ChannelID, m.ID, replyLookahead)
+		if err != nil {
+			return false, err
+		}
+		w = &replyWindow{
+			after:    m.ID,
+			replied:  make(map[discord.MessageID]bool),
+			complete: len(ms) < replyLookahead,
+		}
+		for i := len(ms) - 1; i >= 0; i-- {
+			w.ids = append(w.ids, ms[i].ID)
+			if ms[i].Author.ID != f.self && ms[i].Reference != nil {
+				w.replied[ms[i].Reference.MessageID] = true
+			}
+		}
+		if f.windows == nil {
+			f.windows = make(map[discord.ChannelID]*replyWindow)
+		}
+		f.windows[m.ChannelID] = w
+	}
+	return w.replied[m.ID], nil
+}
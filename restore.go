@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/api/webhook"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/sendpart"
+)
+
+// maxWebhookFiles is the most files a webhook message may carry.
+const maxWebhookFiles = 10
+
+// restore re-posts archived messages through a webhook, each in an embed
+// carrying its original author and time, along with the archived copies of
+// its attachments.
+func restore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	archive := fs.String("archive", "./archive", "Directory of the archive to restore messages from")
+	archiveFile := fs.String("archive-file", "messages", "Name of the message log in the archive directory, without its .db extension")
+	instance := fs.String("instance", "", "Name of the instance whose archive database to read")
+	webhookURL := fs.String("webhook", "", "URL of the webhook to post the messages with")
+	apiBase := fs.String("api-base", "", "Send API requests to this base URL instead of https://discord.com")
+	var channels snowflakes
+	fs.Var(&channels, "channel", "Comma-separated list of the channel IDs whose messages are restored; may be repeated")
+	var after, before date
+	fs.Var(&after, "after", "Only restore messages sent after this date, like 2006-01-02 or 2006-01-02T15:04:05Z")
+	fs.Var(&before, "before", "Only restore messages sent before this date, like 2006-01-02 or 2006-01-02T15:04:05Z")
+	match := fs.String("match", "", "Only restore messages whose content matches this regular expression")
+	delay := fs.Duration("delay", time.Second, "Delay between messages")
+	if err := fs.Parse(args); err != nil {
+		return configError{err.Error()}
+	}
+	if *webhookURL == "" {
+		return configErrorf("-webhook must be specified")
+	}
+	if len(channels) == 0 {
+		return configErrorf("-channel must be specified")
+	}
+	var re *regexp.Regexp
+	if *match != "" {
+		var err error
+		re, err = regexp.Compile(*match)
+		if err != nil {
+			return configErrorf("invalid -match: %s", err)
+		}
+	}
+	id, token, err := webhook.ParseURL(*webhookURL)
+	if err != nil {
+		return configErrorf("invalid -webhook: %s", err)
+	}
+	c := api.NewClient("")
+	if err := setAPIBase(c, *apiBase); err != nil {
+		return configErrorf("invalid -api-base: %s", err)
+	}
+	wh := webhook.FromAPI(id, token, c)
+
+	file := *archiveFile
+	if *instance != "" {
+		file += "-" + *instance
+	}
+	name := path.Join(*archive, file+".db")
+	if _, err := os.Stat(name); err != nil {
+		return configErrorf("opening archive: %s", err)
+	}
+	// The archive is only read, so it's opened as is, without taking its
+	// lock or touching its schema and permissions.
+	db, err := sql.Open("sqlite3", "file:"+name+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer db.Close()
+	o := &output{DB: db, attdir: path.Join(*archive, "attachments")}
+
+	var msgs []discord.Message
+	err = o.messages(func(m discord.Message) error {
+		switch {
+		case !channels.contains(discord.Snowflake(m.ChannelID)):
+		case !time.Time(after).IsZero() && !m.ID.Time().After(time.Time(after)):
+		case !time.Time(before).IsZero() && !m.ID.Time().Before(time.Time(before)):
+		case re != nil && !re.MatchString(m.Content):
+		default:
+			msgs = append(msgs, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+	log.Printf("Restoring %d messages.\n", len(msgs))
+	for i, m := range msgs {
+		if i > 0 {
+			time.Sleep(*delay)
+		}
+		data, files := restoredMessage(o, m)
+		err := wh.Execute(data)
+		for _, f := range files {
+			f.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("restoring %s: %w", m.URL(), err)
+		}
+	}
+	log.Printf("Restored %d messages.\n", len(msgs))
+	return nil
+}
+
+// restoredMessage builds the webhook message restoring m, with the archived
+// copies of its attachments, whose files the caller must close.
+func restoredMessage(o *output, m discord.Message) (webhook.ExecuteData, []*os.File) {
+	embed := discord.Embed{
+		Author: &discord.EmbedAuthor{
+			Name: m.Author.DisplayOrUsername(),
+			Icon: m.Author.AvatarURL(),
+		},
+		Description: m.Content,
+		Timestamp:   m.Timestamp,
+		Footer:      &discord.EmbedFooter{Text: "Restored from " + m.URL()},
+	}
+	data := webhook.ExecuteData{
+		Username:        m.Author.DisplayOrUsername(),
+		AvatarURL:       m.Author.AvatarURL(),
+		AllowedMentions: &api.AllowedMentions{Parse: []api.AllowedMentionType{}},
+	}
+	var files []*os.File
+	for n, att := range m.Attachments {
+		f, err := os.Open(o.attachmentPath(m, n))
+		if err != nil || len(files) == maxWebhookFiles {
+			if f != nil {
+				f.Close()
+			}
+			embed.Fields = append(embed.Fields, discord.EmbedField{Name: "Missing attachment", Value: att.Filename})
+			continue
+		}
+		files = append(files, f)
+		data.Files = append(data.Files, sendpart.File{Name: att.Filename, Reader: f})
+	}
+	data.Embeds = []discord.Embed{embed}
+	return data, files
+}
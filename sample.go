@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// sampler picks a random subset of the user's messages that would otherwise
+// be deleted, either a percentage of them or a number of them.
+type sampler struct {
+	// percent, if set, is the chance of picking each message.
+	percent float64
+	// n is the number of messages to pick if percent isn't set. They are
+	// picked evenly among the candidates, which countSamples counts
+	// beforehand; should the count fall short, messages are picked until
+	// there are n.
+	n      int
+	picked int
+	// candidates is the number of candidates left to be asked about.
+	candidates uint
+	// self, if set, is the user whose messages are sampled. The messages of
+	// others are always picked, since they're never deleted anyway.
+	self discord.UserID
+	rand *rand.Rand
+}
+
+// parseSample parses a -sample value, either a number of messages or a
+// percentage like 10%.
+func parseSample(s string) (*sampler, error) {
+	sm := &sampler{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	if pct := strings.TrimSuffix(s, "%"); pct != s {
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("%q isn't a percentage from 0 to 100", s)
+		}
+		sm.percent = p
+		return sm, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("%q isn't a positive number of messages or a percentage", s)
+	}
+	sm.n = n
+	return sm, nil
+}
+
+// pick reports whether to pick m.
+func (s *sampler) pick(m discord.Message) bool {
+	if s.self.IsValid() && m.Author.ID != s.self {
+		return true
+	}
+	if s.percent > 0 {
+		return s.rand.Float64()*100 < s.percent
+	}
+	if s.picked >= s.n {
+		return false
+	}
+	if s.candidates > 0 {
+		p := float64(s.n-s.picked) / float64(s.candidates)
+		s.candidates--
+		if s.rand.Float64() >= p {
+			return false
+		}
+	}
+	s.picked++
+	return true
+}
+
+// countSamples counts the candidates of the samplers that pick a number of
+// messages, by going through targets as -estimate does, so that the sample
+// is spread evenly over all of them. base is the policy of the targets
+// without one of their own.
+func (d *deleter) countSamples(ctx context.Context, targets []target, base *policy) error {
+	est, timeout, processed, st, p := d.estimate, d.channelTimeout, d.processed, d.stats, d.policy
+	defer func() {
+		d.estimate, d.channelTimeout, d.processed, d.stats, d.policy = est, timeout, processed, st, p
+	}()
+	d.channelTimeout = 0
+	counts := make(map[*sampler]uint)
+	for _, t := range targets {
+		d.policy = base
+		if t.policy != nil {
+			d.policy = t.policy
+		}
+		sm := d.policy.sample
+		if sm == nil || sm.percent > 0 {
+			continue
+		}
+		if len(counts) == 0 {
+			log.Println("Counting the messages to sample from")
+		}
+		d.estimate = new(estimate)
+		d.policy.sample = nil
+		err := d.purge(ctx, &t)
+		d.policy.sample = sm
+		if err != nil {
+			return err
+		}
+		counts[sm] += d.estimate.messages
+	}
+	for sm, n := range counts {
+		sm.candidates = n
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+)
+
+// searchPage is a page of search results.
+type searchPage struct {
+	api.SearchResponse
+	// Cursor points at the next page, if Discord pages search results with
+	// an opaque cursor rather than by message ID.
+	Cursor json.RawMessage `json:"cursor,omitempty"`
+}
+
+// cursor returns the page's cursor as a query parameter, or "" if there is
+// none.
+func (p *searchPage) cursor() string {
+	if len(p.Cursor) == 0 || string(p.Cursor) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(p.Cursor, &s); err == nil {
+		return s
+	}
+	return string(p.Cursor)
+}
+
+// searchHas are the kinds of content that searches can be narrowed to.
+var searchHas = []string{"link", "embed", "file", "image", "video", "sound"}
+
+// searchQuery is the state of a search between pages.
+type searchQuery struct {
+	api.SearchData
+	Cursor string
+}
+
+// pagination moves q to the page after page, the last message on which was
+// last.
+type pagination func(q *searchQuery, page *searchPage, last discord.MessageID)
+
+var paginations = map[string]pagination{
+	"id":     paginateByID,
+	"cursor": paginateByCursor,
+}
+
+// paginateByID continues the search after the last message.
+func paginateByID(q *searchQuery, page *searchPage, last discord.MessageID) {
+	if last+1 > q.MinID {
+		q.MinID = last + 1
+	}
+}
+
+// paginateByCursor continues the search from the page's cursor, falling back
+// to paginateByID if there isn't one.
+func paginateByCursor(q *searchQuery, page *searchPage, last discord.MessageID) {
+	if cur := page.cursor(); cur != "" {
+		q.Cursor = cur
+		return
+	}
+	paginateByID(q, page, last)
+}
+
+// maxStalls is the number of pages in a row that may bring neither new
+// messages nor fewer results before a search is given up on.
+const maxStalls = 3
+
+// search calls fn with each of the user's messages in t, oldest first, and
+// page with the number of remaining results before each page. It stops at
+// the first error returned by fn.
+func (d *deleter) search(ctx context.Context, t target, page func(total uint) error, fn func(discord.Message) error) error {
+	q := searchQuery{SearchData: api.SearchData{
+		SortBy:    "timestamp",
+		SortOrder: "asc",
+		AuthorID:  d.self,
+		ChannelID: t.channelID,
+		Mentions:  d.policy.mentions,
+	}}
+	if !d.policy.after.IsZero() {
+		q.MinID = discord.MessageID(discord.NewSnowflake(d.policy.after))
+	}
+	if !d.policy.before.IsZero() {
+		q.MaxID = discord.MessageID(discord.NewSnowflake(d.policy.before))
+	}
+	if d.policy.minID > q.MinID {
+		q.MinID = d.policy.minID
+	}
+	if d.policy.maxID.IsValid() && (!q.MaxID.IsValid() || d.policy.maxID+1 < q.MaxID) {
+		q.MaxID = d.policy.maxID + 1
+	}
+	if t.after.IsValid() && t.after+1 > q.MinID {
+		q.MinID = t.after + 1
+	}
+	var (
+		last      = t.after
+		lastTotal uint
+		stalls    int
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		results, err := d.searchPage(t, q)
+		if err != nil {
+			d.events.emit(event{Type: "error", GuildID: t.guildID, ChannelID: t.channelID, Error: err.Error()})
+			return fmt.Errorf("searching messages in %s: %w", t, err)
+		}
+		d.events.emit(event{Type: "page_fetched", GuildID: t.guildID, ChannelID: t.channelID, Total: results.TotalResults})
+		if page != nil {
+			if err := page(results.TotalResults); err != nil {
+				return err
+			}
+		}
+		if results.TotalResults == 0 {
+			return nil
+		}
+		var (
+			progressed bool
+			pageMax    discord.MessageID
+		)
+		for _, result := range results.Messages {
+			for _, m := range result {
+				if m.ID > pageMax {
+					pageMax = m.ID
+				}
+				if m.ID <= last {
+					continue
+				}
+				// Search results don't carry a guild ID, but the channel ID
+				// is always the message's own, which may be a thread or some
+				// other channel than the target's.
+				if !m.GuildID.IsValid() {
+					m.GuildID = t.guildID
+				}
+				if err := fn(m); err != nil {
+					return err
+				}
+				last = m.ID
+				progressed = true
+			}
+		}
+		if !progressed && lastTotal != 0 && results.TotalResults >= lastTotal {
+			stalls++
+			if stalls >= maxStalls {
+				log.Printf("Search in %s stopped making progress with %d results left, giving up on it\n", t, results.TotalResults)
+				return nil
+			}
+		} else {
+			stalls = 0
+		}
+		lastTotal = results.TotalResults
+		prev := q
+		d.paginate(&q, results, last)
+		// If the page held nothing new, e.g. because it overlapped the
+		// previous one, the pagination may not have moved. Skip past
+		// everything on the page so the same window isn't fetched forever.
+		if q == prev && pageMax >= q.MinID {
+			q.MinID = pageMax + 1
+			q.Cursor = ""
+		}
+	}
+}
+
+// unfiltered lifts the filters that narrow down searches, -has and
+// -mentions everyone, until the returned function is called.
+func (d *deleter) unfiltered() (restore func()) {
+	has, p := d.has, d.policy
+	d.has, d.policy = nil, &policy{}
+	return func() { d.has, d.policy = has, p }
+}
+
+// remaining returns how many of the user's messages search finds in a
+// guild, or in one of its channels if chid is valid, regardless of the
+// filters.
+func (d *deleter) remaining(gid discord.GuildID, chid discord.ChannelID) (uint, error) {
+	defer d.unfiltered()()
+	q := searchQuery{SearchData: api.SearchData{AuthorID: d.self, ChannelID: chid}}
+	page, err := d.searchPage(target{guildID: gid, channelID: chid}, q)
+	if err != nil {
+		return 0, err
+	}
+	return page.TotalResults, nil
+}
+
+// latestMessages returns the IDs of the user's latest n messages in a
+// channel, newest first.
+func (d *deleter) latestMessages(gid discord.GuildID, chid discord.ChannelID, n int) ([]discord.MessageID, error) {
+	defer d.unfiltered()()
+	t := target{guildID: gid, channelID: chid}
+	q := searchQuery{SearchData: api.SearchData{
+		SortBy:    "timestamp",
+		SortOrder: "desc",
+		AuthorID:  d.self,
+		ChannelID: chid,
+	}}
+	var ids []discord.MessageID
+	for len(ids) < n {
+		results, err := d.searchPage(t, q)
+		if err != nil {
+			return nil, err
+		}
+		before := len(ids)
+		for _, result := range results.Messages {
+			for _, m := range result {
+				if len(ids) == n || m.Author.ID != d.self || m.ChannelID != chid {
+					continue
+				}
+				if len(ids) > 0 && m.ID >= ids[len(ids)-1] {
+					continue
+				}
+				ids = append(ids, m.ID)
+			}
+		}
+		if len(ids) == before {
+			break
+		}
+		q.MaxID = ids[len(ids)-1]
+	}
+	return ids, nil
+}
+
+// searchPage fetches a page of search results.
+func (d *deleter) searchPage(t target, q searchQuery) (*searchPage, error) {
+	var endpoint string
+	if t.guildID.IsValid() {
+		endpoint = api.EndpointGuilds + t.guildID.String() + "/messages/search"
+	} else {
+		endpoint = api.EndpointChannels + q.ChannelID.String() + "/messages/search"
+	}
+	opts := []httputil.RequestOption{httputil.WithSchema(d.c.Client, q.SearchData)}
+	if q.Cursor != "" {
+		opts = append(opts, func(r httpdriver.Request) error {
+			r.AddQuery(url.Values{"cursor": {q.Cursor}})
+			return nil
+		})
+	}
+	if len(d.has) > 0 {
+		// SearchData only takes a single has filter.
+		opts = append(opts, func(r httpdriver.Request) error {
+			r.AddQuery(url.Values{"has": d.has})
+			return nil
+		})
+	}
+	if d.policy.mentionsEveryone {
+		opts = append(opts, func(r httpdriver.Request) error {
+			r.AddQuery(url.Values{"mention_everyone": {"true"}})
+			return nil
+		})
+	}
+	resp, err := d.c.Client.Request("GET", endpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	body := resp.GetBody()
+	defer body.Close()
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("reading search results: %w", err)
+	}
+	if d.dumps != nil {
+		if err := d.dumps.write(raw); err != nil {
+			log.Println("Warning: couldn't dump search page:", err)
+		}
+	}
+	var page searchPage
+	if err := json.Unmarshal(raw, &page); err != nil {
+		return nil, fmt.Errorf("decoding search results: %w", err)
+	}
+	return &page, nil
+}
+
+// searchDumps writes the raw search pages fetched into a directory, numbered
+// in the order they were fetched.
+type searchDumps struct {
+	dir      string
+	prefix   string
+	fileMode os.FileMode
+	seq      int
+}
+
+// newSearchDumps creates dir, and names the dumps after the time of the run
+// so that runs don't overwrite each other's.
+func newSearchDumps(dir string, dirMode, fileMode os.FileMode) (*searchDumps, error) {
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, err
+	}
+	return &searchDumps{
+		dir:      dir,
+		prefix:   time.Now().Format("20060102-150405"),
+		fileMode: fileMode,
+	}, nil
+}
+
+func (s *searchDumps) write(raw []byte) error {
+	s.seq++
+	name := path.Join(s.dir, fmt.Sprintf("%s-%06d.json", s.prefix, s.seq))
+	return os.WriteFile(name, raw, s.fileMode)
+}
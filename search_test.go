@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestSearchSeveralChannels(t *testing.T) {
+	const gid = 5
+	channels := []discord.ChannelID{10, 11, 12}
+	var msgs []discord.Message
+	for i := 0; i < 9; i++ {
+		msgs = append(msgs, testMessage(testID(i), gid, channels[i%len(channels)], testSelf, "hello"))
+	}
+	// A single page of results holds the messages of every channel.
+	f := newFakeDiscord(msgs...)
+	dir := t.TempDir()
+	f.run(t, "-guild", flagID(gid), "-archive", dir)
+	db := openArchive(t, dir)
+	for _, m := range msgs {
+		if f.deletes[m.ID] != 1 {
+			t.Errorf("%s deleted %d times, want once", m.ID, f.deletes[m.ID])
+		}
+		var chid discord.ChannelID
+		var guild discord.GuildID
+		err := db.QueryRow("SELECT channel, guild FROM Message WHERE id = ?", m.ID).Scan(&chid, &guild)
+		if err != nil {
+			t.Errorf("%s isn't archived: %s", m.ID, err)
+		} else if chid != m.ChannelID || guild != gid {
+			t.Errorf("%s archived in channel %s of guild %s, want %s of %d", m.ID, chid, guild, m.ChannelID, gid)
+		}
+	}
+}
+
+func TestSearchPageOfOthers(t *testing.T) {
+	const gid, chid = 5, 10
+	var msgs, others []discord.Message
+	for i := 0; i < 30; i++ {
+		others = append(others, testMessage(testID(i), gid, chid, 2, "someone else's"))
+	}
+	msgs = append(msgs, others...)
+	for i := 30; i < 33; i++ {
+		msgs = append(msgs, testMessage(testID(i), gid, chid, testSelf, "mine"))
+	}
+	f := newFakeDiscord(msgs...)
+	// Search returns the messages of others too, so the first page holds
+	// none of the user's.
+	f.search = func(q searchParams) searchPage {
+		q.authorID = 0
+		return f.searchPage(q)
+	}
+	out := f.run(t, "-channel", flagID(chid), "-archive", t.TempDir())
+	checkSummary(t, out, "Deleted 3 messages")
+	var want []discord.MessageID
+	for _, m := range others {
+		want = append(want, m.ID)
+	}
+	if left := f.left(); !equalIDs(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+	if f.searches > 4 {
+		t.Errorf("searched %d times, want at most 4", f.searches)
+	}
+}
+
+func TestSearchForcesAdvance(t *testing.T) {
+	const gid, chid = 5, 10
+	first := testMessage(testID(0), gid, chid, testSelf, "first")
+	f := newFakeDiscord(first, testMessage(testID(1), gid, chid, testSelf, "second"))
+	// Paging on from the first page brings the same page and cursor back,
+	// as if the cursor were stuck.
+	f.search = func(q searchParams) searchPage {
+		if q.minID > first.ID {
+			return f.searchPage(q)
+		}
+		var page searchPage
+		page.TotalResults = 2
+		page.Messages = [][]discord.Message{{first}}
+		page.Cursor = []byte(`"stuck"`)
+		return page
+	}
+	out := f.run(t, "-channel", flagID(chid), "-archive", t.TempDir(), "-pagination", "cursor")
+	checkSummary(t, out, "Deleted 2 messages")
+	if left := f.left(); len(left) != 0 {
+		t.Errorf("left %v", left)
+	}
+	if f.deletes[first.ID] != 1 {
+		t.Errorf("deleted the first message %d times, want once", f.deletes[first.ID])
+	}
+	// The first page, its repeat, the page after it, and an empty one.
+	if f.searches != 4 {
+		t.Errorf("searched %d times, want 4", f.searches)
+	}
+}
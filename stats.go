@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+)
+
+// stats counts what happened to the messages of a run.
+type stats struct {
+	deleted uint
+	kept    uint
+	skipped uint
+	failed  uint
+	// archived counts the messages archived without being deleted.
+	archived uint
+
+	// unreacted counts the reactions removed.
+	unreacted uint
+	// unpinned counts the messages unpinned before being deleted.
+	unpinned uint
+	// scrubbed counts the messages edited before being deleted.
+	scrubbed uint
+	// unarchived counts the threads unarchived by sending a message to
+	// them.
+	unarchived uint
+	// skippedThreads counts the messages skipped per archived thread that
+	// wasn't unarchived, by the thread's URL.
+	skippedThreads map[string]uint
+
+	// forumPosts counts the forum posts searched on their own, and
+	// forumDeleted the messages deleted in them.
+	forumPosts   uint
+	forumDeleted uint
+
+	// kinds counts deleted messages per channel kind, when the kinds are
+	// resolved for -channel-type.
+	kinds map[string]uint
+
+	// errors counts the errors that messages were skipped or failed with,
+	// by errorLabel.
+	errors map[string]uint
+
+	// channels and guilds count deleted messages per channel and per
+	// guild, DMs being the null guild.
+	channels map[discord.ChannelID]uint
+	guilds   map[discord.GuildID]uint
+
+	// dryRun makes the deleted messages be the ones that would have been
+	// deleted.
+	dryRun bool
+}
+
+// errorNames are the names of the Discord error codes commonly hit.
+var errorNames = map[httputil.ErrorCode]string{
+	UnknownChannel:                 "Unknown Channel",
+	UnknownMessage:                 "Unknown Message",
+	20028:                          "Rate limited",
+	50001:                          "Missing Access",
+	MissingPermissions:             "Missing Permissions",
+	SystemMessageActionUnavailable: "Cannot execute action on a system message",
+	InvalidActionOnArchivedThread:  "Thread is archived",
+	160005:                         "Thread is locked",
+}
+
+// errorLabel names the kind of err, by its Discord error code if it has one.
+func errorLabel(err error) string {
+	var herr *httputil.HTTPError
+	switch {
+	case errors.As(err, &herr) && herr.Code != 0:
+		if name, ok := errorNames[herr.Code]; ok {
+			return fmt.Sprintf("%d %s", herr.Code, name)
+		}
+		return fmt.Sprintf("%d", herr.Code)
+	case errors.As(err, &herr):
+		return fmt.Sprintf("HTTP %d", herr.Status)
+	case isNetworkError(err):
+		return "network error"
+	}
+	return "other"
+}
+
+func (s *stats) addError(err error) {
+	if s.errors == nil {
+		s.errors = make(map[string]uint)
+	}
+	s.errors[errorLabel(err)]++
+}
+
+func (s *stats) addDeleted(m discord.Message) {
+	s.deleted++
+	if s.channels == nil {
+		s.channels = make(map[discord.ChannelID]uint)
+	}
+	s.channels[m.ChannelID]++
+	if s.guilds == nil {
+		s.guilds = make(map[discord.GuildID]uint)
+	}
+	s.guilds[m.GuildID]++
+}
+
+func (s *stats) addSkippedThread(gid discord.GuildID, chid discord.ChannelID) {
+	if s.skippedThreads == nil {
+		s.skippedThreads = make(map[string]uint)
+	}
+	s.skippedThreads[chanURL(gid, chid)]++
+}
+
+func (s *stats) addKind(kind string) {
+	if s.kinds == nil {
+		s.kinds = make(map[string]uint)
+	}
+	s.kinds[kind]++
+}
+
+func (s *stats) print() {
+	if s.dryRun {
+		log.Println("Dry run, nothing was deleted; the messages counted as deleted are those that would have been.")
+	}
+	if s.archived > 0 {
+		log.Printf("Archived %d messages without deleting them.\n", s.archived)
+	}
+	// Kept messages are skipped on purpose, so they count as skipped too.
+	log.Printf("Deleted %d messages, skipped %d (%d kept by filters), failed to delete %d.\n", s.deleted, s.skipped+s.kept, s.kept, s.failed)
+	if s.unreacted > 0 {
+		log.Printf("Removed %d reactions.\n", s.unreacted)
+	}
+	if s.unpinned > 0 {
+		log.Printf("Unpinned %d messages before deleting them.\n", s.unpinned)
+	}
+	if s.scrubbed > 0 {
+		log.Printf("Edited %d messages before deleting them.\n", s.scrubbed)
+	}
+	if s.unarchived > 0 {
+		log.Printf("Unarchived %d threads by sending a message to them.\n", s.unarchived)
+	}
+	if len(s.skippedThreads) > 0 {
+		threads := make([]string, 0, len(s.skippedThreads))
+		for url := range s.skippedThreads {
+			threads = append(threads, url)
+		}
+		sort.Strings(threads)
+		log.Printf("Skipped messages in %d archived threads that weren't unarchived:\n", len(threads))
+		for _, url := range threads {
+			log.Printf("  %s: %d skipped\n", url, s.skippedThreads[url])
+		}
+	}
+	if s.forumPosts > 0 {
+		log.Printf("Processed %d forum posts, deleted %d messages in them.\n", s.forumPosts, s.forumDeleted)
+	}
+	if len(s.errors) > 0 {
+		labels := make([]string, 0, len(s.errors))
+		for label := range s.errors {
+			labels = append(labels, label)
+		}
+		sort.Slice(labels, func(i, j int) bool {
+			if s.errors[labels[i]] != s.errors[labels[j]] {
+				return s.errors[labels[i]] > s.errors[labels[j]]
+			}
+			return labels[i] < labels[j]
+		})
+		log.Println("Errors:")
+		for _, label := range labels {
+			log.Printf("  %s: %d\n", label, s.errors[label])
+		}
+	}
+	for _, kind := range channelKinds {
+		if n, ok := s.kinds[kind]; ok {
+			log.Printf("  %s channels: %d deleted\n", kind, n)
+		}
+	}
+	if len(s.guilds) > 1 {
+		gids := make([]discord.GuildID, 0, len(s.guilds))
+		for id := range s.guilds {
+			gids = append(gids, id)
+		}
+		sort.Slice(gids, func(i, j int) bool { return s.guilds[gids[i]] > s.guilds[gids[j]] })
+		for _, id := range gids {
+			if id.IsValid() {
+				log.Printf("  guild %s: %d deleted\n", id, s.guilds[id])
+			} else {
+				log.Printf("  DMs: %d deleted\n", s.guilds[id])
+			}
+		}
+	}
+	if len(s.channels) < 2 {
+		return
+	}
+	ids := make([]discord.ChannelID, 0, len(s.channels))
+	for id := range s.channels {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return s.channels[ids[i]] > s.channels[ids[j]] })
+	for _, id := range ids {
+		log.Printf("  channel %s: %d deleted\n", id, s.channels[id])
+	}
+}
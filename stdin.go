@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+)
+
+// purgeReader deletes the messages read from r, one JSON message per line,
+// optionally prefixed by "guild,channel,id " as in the archive's messages
+// file. Lines may also be message links, or bare message IDs in the channel
+// chid. Messages without an author are fetched first, so that lines may
+// carry only an ID and a channel ID. Messages in guilds that the only and
+// skip lists don't allow are skipped.
+func (d *deleter) purgeReader(ctx context.Context, r io.Reader, chid discord.ChannelID, only, skip snowflakes) error {
+	guilds := make(map[discord.ChannelID]discord.GuildID)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		m, ok, err := parseSelected(line, chid)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if line[0] != '{' {
+				_, line, _ = bytes.Cut(line, []byte(" "))
+			}
+			if err := json.Unmarshal(line, &m); err != nil {
+				return fmt.Errorf("reading message: %w", err)
+			}
+		}
+		if !m.ID.IsValid() || !m.ChannelID.IsValid() {
+			log.Println("Warning: skipping a line without a message ID and channel ID")
+			continue
+		}
+		if err := d.purgeListed(ctx, m, guilds, only, skip); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// purgeArchived deletes the user's messages recorded in the archive o, in
+// order of ID. Messages in guilds that the only and skip lists don't allow
+// are skipped.
+func (d *deleter) purgeArchived(ctx context.Context, o *output, only, skip snowflakes) error {
+	// The messages are read up front, since deleting them archives them
+	// again.
+	var msgs []discord.Message
+	err := o.messages(func(m discord.Message) error {
+		if m.Author.ID == d.self {
+			msgs = append(msgs, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+	log.Printf("%d of your messages are in the archive.\n", len(msgs))
+	guilds := make(map[discord.ChannelID]discord.GuildID)
+	for _, m := range msgs {
+		if err := d.purgeListed(ctx, m, guilds, only, skip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeListed deletes a message listed by the user rather than found by
+// search. If it lacks its author or guild, they are fetched first, the
+// guild of its channel being cached in guilds. Messages in guilds that the
+// only and skip lists don't allow are skipped.
+func (d *deleter) purgeListed(ctx context.Context, m discord.Message, guilds map[discord.ChannelID]discord.GuildID, only, skip snowflakes) error {
+	if !m.Author.ID.IsValid() || !m.GuildID.IsValid() {
+		err := d.complete(&m, guilds)
+		var herr *httputil.HTTPError
+		if errors.As(err, &herr) && herr.Code == UnknownMessage {
+			d.stats.skipped++
+			log.Printf("Skipping %s, it no longer exists\n", m.URL())
+			return nil
+		}
+		if err != nil {
+			d.stats.failed++
+			d.stats.addError(err)
+			log.Printf("Error fetching %s: %s\n", m.URL(), err)
+			return nil
+		}
+	}
+	if !guildAllowed(m.GuildID, only, skip) {
+		log.Printf("Skipping %s\n", m.URL())
+		return nil
+	}
+	if err := d.waitPause(ctx); err != nil {
+		return err
+	}
+	if err := d.handle(ctx, m); err != nil {
+		return err
+	}
+	d.processed++
+	return nil
+}
+
+// messageLinkRe matches message links, capturing the guild or @me, the
+// channel and the message.
+var messageLinkRe = regexp.MustCompile(`^https?://(?:[a-z]+\.)?discord(?:app)?\.com/channels/(@me|\d+)/(\d+)/(\d+)$`)
+
+// parseSelected parses line as a message link or a bare message ID in the
+// channel chid. It reports false if line is neither.
+func parseSelected(line []byte, chid discord.ChannelID) (discord.Message, bool, error) {
+	var m discord.Message
+	if sm := messageLinkRe.FindSubmatch(line); sm != nil {
+		if string(sm[1]) != "@me" {
+			id, _ := discord.ParseSnowflake(string(sm[1]))
+			m.GuildID = discord.GuildID(id)
+		}
+		cid, _ := discord.ParseSnowflake(string(sm[2]))
+		mid, _ := discord.ParseSnowflake(string(sm[3]))
+		m.ChannelID, m.ID = discord.ChannelID(cid), discord.MessageID(mid)
+		return m, true, nil
+	}
+	id, err := discord.ParseSnowflake(string(line))
+	if err != nil {
+		return m, false, nil
+	}
+	if !chid.IsValid() {
+		return m, false, fmt.Errorf("message ID %s needs -channel to be looked up in", id)
+	}
+	m.ChannelID, m.ID = chid, discord.MessageID(id)
+	return m, true, nil
+}
+
+// complete fetches what a message read from a line may lack: the message
+// itself if it has no author, and the guild of its channel, which is cached
+// in guilds.
+func (d *deleter) complete(m *discord.Message, guilds map[discord.ChannelID]discord.GuildID) error {
+	if !m.Author.ID.IsValid() {
+		fetched, err := d.c.Message(m.ChannelID, m.ID)
+		if err != nil {
+			return err
+		}
+		*m = *fetched
+	}
+	if m.GuildID.IsValid() {
+		return nil
+	}
+	gid, ok := guilds[m.ChannelID]
+	if !ok {
+		ch, err := d.c.Channel(m.ChannelID)
+		if err != nil {
+			return err
+		}
+		gid = ch.GuildID
+		guilds[m.ChannelID] = gid
+	}
+	m.GuildID = gid
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+)
+
+// channelLinkRe matches channel and message links, capturing the guild or
+// @me and the channel.
+var channelLinkRe = regexp.MustCompile(`^https?://(?:[a-z]+\.)?discord(?:app)?\.com/channels/(@me|\d+)/(\d+)(?:/\d+)?$`)
+
+// readTargets reads the targets listed in the file name, one per line, as
+// a guild ID, a channel ID, or a channel or message link, which targets the
+// channel. Blank lines and lines starting with # are ignored. IDs are
+// looked up as channels first, then taken as guilds.
+//
+// A target may be followed by filter flags, which override those of base
+// for it alone, and by -archive=false to not archive its messages; values
+// with spaces may be quoted. -exclude-channels and -exclude-users add to
+// base's lists rather than replace them. archiving tells whether the run
+// archives.
+func readTargets(c *api.Client, name string, base policyFlags, archiving bool) ([]target, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var targets []target
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args, err := splitArgs(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		t, err := parseTarget(c, args[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if len(args) > 1 {
+			t.policy, t.noArchive, err = targetOverrides(args[1:], base, archiving)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, sc.Err()
+}
+
+// parseTarget parses a guild ID, a channel ID, or a channel or message
+// link.
+func parseTarget(c *api.Client, s string) (target, error) {
+	var t target
+	if sm := channelLinkRe.FindStringSubmatch(s); sm != nil {
+		if sm[1] != "@me" {
+			id, _ := discord.ParseSnowflake(sm[1])
+			t.guildID = discord.GuildID(id)
+		}
+		id, _ := discord.ParseSnowflake(sm[2])
+		t.channelID = discord.ChannelID(id)
+		return t, nil
+	}
+	id, err := discord.ParseSnowflake(s)
+	if err != nil {
+		return t, fmt.Errorf("%q isn't an ID or a link", s)
+	}
+	ch, err := c.Channel(discord.ChannelID(id))
+	var herr *httputil.HTTPError
+	switch {
+	case err == nil:
+		return target{guildID: ch.GuildID, channelID: ch.ID}, nil
+	case errors.As(err, &herr) && herr.Code == UnknownChannel:
+		return target{guildID: discord.GuildID(id)}, nil
+	default:
+		return t, fmt.Errorf("fetching channel %s: %w", id, err)
+	}
+}
+
+// targetOverrides parses the flags following a target. It returns the
+// target's own policy, or nil if no filter flag is given, and whether its
+// messages aren't archived.
+func targetOverrides(args []string, base policyFlags, archiving bool) (*policy, bool, error) {
+	fs := flag.NewFlagSet("target", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var pf policyFlags
+	pf.register(fs)
+	// Registering sets the defaults, which the run's own flags replace. The
+	// lists are copied, since parsing appends to them.
+	pf = base
+	pf.excludeChannels = append(snowflakes(nil), base.excludeChannels...)
+	pf.excludeUsers = append(snowflakes(nil), base.excludeUsers...)
+	archive := fs.Bool("archive", archiving, "")
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+	if fs.NArg() > 0 {
+		return nil, false, fmt.Errorf("unexpected %q", fs.Arg(0))
+	}
+	if *archive && !archiving {
+		return nil, false, errors.New("-archive needs the run to have an archive")
+	}
+	filtered := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "archive" {
+			filtered = true
+		}
+	})
+	if !filtered {
+		return nil, !*archive, nil
+	}
+	p, err := pf.policy()
+	if err != nil {
+		return nil, false, err
+	}
+	return p, !*archive, nil
+}
+
+// splitArgs splits s into space-separated arguments, which may be quoted
+// with double or single quotes.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		inArg bool
+		quote rune
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestTargetOverridesExclusions(t *testing.T) {
+	base := policyFlags{excludeChannels: make(snowflakes, 1, 4)}
+	base.excludeChannels[0] = 10
+	excluded := []discord.Snowflake{11, 12}
+	var policies []*policy
+	for _, id := range excluded {
+		p, _, err := targetOverrides([]string{"-exclude-channels", id.String()}, base, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		policies = append(policies, p)
+	}
+	// Each target's exclusions add to the run's, and only its own.
+	for i, p := range policies {
+		for _, id := range []discord.Snowflake{10, 11, 12} {
+			m := testMessage(testID(0), 5, discord.ChannelID(id), testSelf, "hello")
+			want := id == 10 || id == excluded[i]
+			if _, include := p.shouldDelete(m); !include != want {
+				t.Errorf("target excluding %s: channel %s excluded %t, want %t", excluded[i], id, !include, want)
+			}
+		}
+	}
+	if len(base.excludeChannels) != 1 {
+		t.Errorf("run's exclusions changed to %v", base.excludeChannels)
+	}
+}
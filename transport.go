@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+)
+
+// setAPIBase makes c send its requests to base instead of
+// https://discord.com, unless base is empty.
+func setAPIBase(c *api.Client, base string) error {
+	if base == "" {
+		return nil
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	c.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: rebaseTransport{u, http.DefaultTransport},
+	})
+	// The gateway URL is fetched with a client of its own.
+	api.EndpointGateway = strings.TrimSuffix(base, "/") + api.Path + "/gateway"
+	return nil
+}
+
+// rebaseTransport redirects requests to the Discord API to another base URL,
+// such as a mock server.
+type rebaseTransport struct {
+	base *url.URL
+	http.RoundTripper
+}
+
+func (t rebaseTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host == "discord.com" {
+		r = r.Clone(r.Context())
+		r.URL.Scheme = t.base.Scheme
+		r.URL.Host = t.base.Host
+		r.URL.Path = strings.TrimSuffix(t.base.Path, "/") + r.URL.Path
+		r.Host = ""
+	}
+	return t.RoundTripper.RoundTrip(r)
+}
+
+// newAttachmentClient returns the client attachments are downloaded with.
+// It is shared by all downloads so that connections to the CDN are kept
+// alive between them, and it gives up on unresponsive servers.
+func newAttachmentClient() *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 16
+	t.ResponseHeaderTimeout = 30 * time.Second
+	return &http.Client{Transport: t}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// wizard interactively builds the flags of a run across the guilds and DMs
+// the user picks, confirms the plan, and runs it.
+func wizard(args []string) error {
+	fs := flag.NewFlagSet("wizard", flag.ContinueOnError)
+	token := fs.String("token", "", "Discord user token, asked for if not given")
+	apiBase := fs.String("api-base", "", "Base URL of the Discord API, for testing against a mock server")
+	if err := fs.Parse(args); err != nil {
+		return configError{err.Error()}
+	}
+	in := bufio.NewReader(os.Stdin)
+	if *token == "" {
+		t, err := ask(in, "Token")
+		if err != nil {
+			return err
+		}
+		*token = t
+	}
+	c := api.NewClient(*token)
+	if err := setAPIBase(c, *apiBase); err != nil {
+		return configErrorf("invalid -api-base: %s", err)
+	}
+	guilds, err := c.Guilds(0)
+	if err != nil {
+		return fmt.Errorf("fetching guilds: %w", err)
+	}
+	dms, err := c.PrivateChannels()
+	if err != nil {
+		return fmt.Errorf("fetching DMs: %w", err)
+	}
+
+	// Guilds are listed first, then DMs, numbered from 1.
+	fmt.Fprintln(os.Stderr, "Guilds and DMs:")
+	n := 0
+	for _, g := range guilds {
+		n++
+		fmt.Fprintf(os.Stderr, "  %3d  %s (%s)\n", n, g.Name, g.ID)
+	}
+	for _, ch := range dms {
+		n++
+		fmt.Fprintf(os.Stderr, "  %3d  %s (%s)\n", n, dmName(ch), ch.ID)
+	}
+	picked, err := askPicks(in, "Purge which (like 1,3,5-7 or all)", n)
+	if err != nil {
+		return err
+	}
+	var pickedGuilds, pickedDMs []string
+	var names []string
+	for _, i := range picked {
+		if i < len(guilds) {
+			pickedGuilds = append(pickedGuilds, guilds[i].ID.String())
+			names = append(names, guilds[i].Name)
+		} else {
+			ch := dms[i-len(guilds)]
+			pickedDMs = append(pickedDMs, ch.ID.String())
+			names = append(names, dmName(ch))
+		}
+	}
+
+	runArgs := []string{"-token", *token}
+	if *apiBase != "" {
+		runArgs = append(runArgs, "-api-base", *apiBase)
+	}
+	if len(pickedGuilds) > 0 {
+		runArgs = append(runArgs, "-guild", strings.Join(pickedGuilds, ","))
+	}
+	if len(pickedDMs) > 0 {
+		runArgs = append(runArgs, "-channel", strings.Join(pickedDMs, ","))
+	}
+	questions := []struct {
+		question, flag string
+	}{
+		{"Archive directory (blank for ./archive, - for no archive)", "archive"},
+		{"Only delete messages sent after (like 2006-01-02, blank for no limit)", "after"},
+		{"Only delete messages sent before (like 2006-01-02, blank for no limit)", "before"},
+		{"Only delete messages matching (a regular expression, blank for all)", "match"},
+		{"Never delete messages matching (a regular expression, blank for none)", "keep-match"},
+	}
+	for _, q := range questions {
+		answer, err := ask(in, q.question)
+		if err != nil {
+			return err
+		}
+		switch {
+		case answer == "":
+		case q.flag == "archive" && answer == "-":
+			runArgs = append(runArgs, "-archive=")
+		default:
+			runArgs = append(runArgs, "-"+q.flag, answer)
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "Your messages will be deleted in:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+	shown := append([]string{os.Args[0]}, runArgs...)
+	shown[2] = "$TOKEN"
+	fmt.Fprintf(os.Stderr, "The same run can be started with:\n  %s\n", strings.Join(shown, " "))
+	ok, err := confirm(in, "Go ahead?")
+	if err != nil {
+		return fmt.Errorf("reading confirmation: %w", err)
+	}
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Not confirmed, stopping")
+		return nil
+	}
+	os.Args = append([]string{os.Args[0]}, runArgs...)
+	return run()
+}
+
+// ask asks for a line of input, with surrounding whitespace trimmed.
+func ask(in *bufio.Reader, question string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", question)
+	answer, err := in.ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		return "", fmt.Errorf("reading answer: %w", err)
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// askPicks asks which of n numbered items to pick, and returns their
+// indices, in order and without duplicates.
+func askPicks(in *bufio.Reader, question string, n int) ([]int, error) {
+	for {
+		answer, err := ask(in, question)
+		if err != nil {
+			return nil, err
+		}
+		picks, err := parsePicks(answer, n)
+		if err == nil && len(picks) > 0 {
+			return picks, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("nothing picked")
+		}
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// parsePicks parses a list of numbers and ranges from 1 to n, or all.
+func parsePicks(s string, n int) ([]int, error) {
+	picked := make([]bool, n)
+	if s == "all" {
+		for i := range picked {
+			picked[i] = true
+		}
+	} else {
+		for _, part := range strings.Split(s, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			from, to, isRange := strings.Cut(part, "-")
+			if !isRange {
+				to = from
+			}
+			lo, err1 := strconv.Atoi(strings.TrimSpace(from))
+			hi, err2 := strconv.Atoi(strings.TrimSpace(to))
+			if err1 != nil || err2 != nil || lo < 1 || hi > n || lo > hi {
+				return nil, fmt.Errorf("%q isn't a number or range from 1 to %d", part, n)
+			}
+			for i := lo; i <= hi; i++ {
+				picked[i-1] = true
+			}
+		}
+	}
+	var picks []int
+	for i, p := range picked {
+		if p {
+			picks = append(picks, i)
+		}
+	}
+	return picks, nil
+}
+
+// dmName names a DM after its recipients, or a group DM after its name.
+func dmName(ch discord.Channel) string {
+	name := groupDMName(ch)
+	if name == "" {
+		name = ch.ID.String()
+	}
+	if ch.Type == discord.GroupDM {
+		return "group DM " + name
+	}
+	return "DM with " + name
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// wordMatcher finds whole words and phrases from a list in text, ignoring
+// case. It is an Aho-Corasick automaton over the bytes of the lowercased
+// words, so that it scans text once however long the list is.
+type wordMatcher struct {
+	next []map[byte]int
+	fail []int
+	// lens are the lengths of the words that end at each state.
+	lens [][]int
+}
+
+// readWordlist reads a list of words and phrases, one per line. Empty lines
+// and lines starting with # are ignored.
+func readWordlist(name string) (*wordMatcher, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		w := strings.TrimSpace(sc.Text())
+		if w == "" || strings.HasPrefix(w, "#") {
+			continue
+		}
+		words = append(words, w)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return newWordMatcher(words), nil
+}
+
+func newWordMatcher(words []string) *wordMatcher {
+	wm := &wordMatcher{next: []map[byte]int{{}}, lens: [][]int{nil}}
+	for _, w := range words {
+		w = strings.ToLower(w)
+		s := 0
+		for i := 0; i < len(w); i++ {
+			n, ok := wm.next[s][w[i]]
+			if !ok {
+				n = len(wm.next)
+				wm.next = append(wm.next, map[byte]int{})
+				wm.lens = append(wm.lens, nil)
+				wm.next[s][w[i]] = n
+			}
+			s = n
+		}
+		wm.lens[s] = append(wm.lens[s], len(w))
+	}
+	// Compute the failure links breadth first, so that a state's link is
+	// known before those of its children.
+	wm.fail = make([]int, len(wm.next))
+	queue := make([]int, 0, len(wm.next))
+	for _, n := range wm.next[0] {
+		queue = append(queue, n)
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for b, n := range wm.next[s] {
+			f := wm.fail[s]
+			for f != 0 && wm.next[f][b] == 0 {
+				f = wm.fail[f]
+			}
+			if fn, ok := wm.next[f][b]; ok && fn != n {
+				wm.fail[n] = fn
+			}
+			wm.lens[n] = append(wm.lens[n], wm.lens[wm.fail[n]]...)
+			queue = append(queue, n)
+		}
+	}
+	return wm
+}
+
+// matches reports whether text contains one of the words, not as part of a
+// longer word.
+func (wm *wordMatcher) matches(text string) bool {
+	text = strings.ToLower(text)
+	s := 0
+	for i := 0; i < len(text); i++ {
+		b := text[i]
+		for s != 0 && wm.next[s][b] == 0 {
+			s = wm.fail[s]
+		}
+		s = wm.next[s][b]
+		for _, l := range wm.lens[s] {
+			if isWordBoundary(text, i+1-l) && isWordBoundary(text, i+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isWordBoundary reports whether the byte offset i of text isn't between
+// two letters or digits.
+func isWordBoundary(text string, i int) bool {
+	if i == 0 || i == len(text) {
+		return true
+	}
+	before, _ := utf8.DecodeLastRuneInString(text[:i])
+	after, _ := utf8.DecodeRuneInString(text[i:])
+	return !isWordRune(before) || !isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
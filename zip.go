@@ -0,0 +1,80 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// zipArchive is an archive kept in a single zip file. Attachments are
+// streamed into it as they're downloaded, and each message is written as
+// soon as it's archived, as a messages/<id> entry holding its line in the
+// format of the old line-based archive. The zip is only valid once closed,
+// which happens even if the run is interrupted; if the process is killed
+// instead, the entries can be salvaged with zip -FF.
+type zipArchive struct {
+	f *os.File
+	w *zip.Writer
+	// names and ids are the entries and messages written in full.
+	names map[string]bool
+	ids   map[discord.MessageID]bool
+}
+
+// newZipArchive creates the zip file name. It fails if the file exists,
+// rather than overwrite an earlier archive.
+func newZipArchive(name string, mode os.FileMode) (*zipArchive, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &zipArchive{f: f, w: zip.NewWriter(f), names: make(map[string]bool), ids: make(map[discord.MessageID]bool)}, nil
+}
+
+// write adds the entry name with the contents read from r, and flushes it to
+// the file. The entry only counts as written once all of r is.
+func (z *zipArchive) write(name string, r io.Reader) error {
+	w, err := z.w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	if err := z.w.Flush(); err != nil {
+		return err
+	}
+	z.names[name] = true
+	return nil
+}
+
+// exists reports whether an entry was written.
+func (z *zipArchive) exists(name string) bool {
+	return z.names[name]
+}
+
+// addMessage writes the entry of m, whose JSON is j.
+func (z *zipArchive) addMessage(m discord.Message, j []byte) error {
+	line := fmt.Sprintf("%d,%d,%d %s\n", m.GuildID, m.ChannelID, m.ID, j)
+	if err := z.write(fmt.Sprintf("messages/%d", m.ID), strings.NewReader(line)); err != nil {
+		return err
+	}
+	z.ids[m.ID] = true
+	return nil
+}
+
+func (z *zipArchive) Close() error {
+	err := z.w.Close()
+	if cerr := z.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}